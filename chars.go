@@ -0,0 +1,196 @@
+package gosaxml
+
+import (
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// classes of the ASCII characters in names
+// (https://www.w3.org/TR/xml/#NT-Name)
+const (
+	nameChar      = 1
+	nameStartChar = 2
+)
+
+var nameChars = generateNameTable()
+
+func generateNameTable() [utf8.RuneSelf]byte {
+	var s [utf8.RuneSelf]byte
+	for b := 'a'; b <= 'z'; b++ {
+		s[b] = nameStartChar | nameChar
+		s[b-'a'+'A'] = nameStartChar | nameChar
+	}
+	for b := '0'; b <= '9'; b++ {
+		s[b] = nameChar
+	}
+	s[':'] = nameStartChar | nameChar
+	s['_'] = nameStartChar | nameChar
+	s['-'] = nameChar
+	s['.'] = nameChar
+	return s
+}
+
+// isNameStartRune reports whether r is a NameStartChar
+// outside of the ASCII range.
+func isNameStartRune(r rune) bool {
+	return r >= 0xC0 && r <= 0xD6 ||
+		r >= 0xD8 && r <= 0xF6 ||
+		r >= 0xF8 && r <= 0x2FF ||
+		r >= 0x370 && r <= 0x37D ||
+		r >= 0x37F && r <= 0x1FFF ||
+		r >= 0x200C && r <= 0x200D ||
+		r >= 0x2070 && r <= 0x218F ||
+		r >= 0x2C00 && r <= 0x2FEF ||
+		r >= 0x3001 && r <= 0xD7FF ||
+		r >= 0xF900 && r <= 0xFDCF ||
+		r >= 0xFDF0 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= 0xEFFFF
+}
+
+// isNameRune reports whether r is a NameChar
+// outside of the ASCII range.
+func isNameRune(r rune) bool {
+	return isNameStartRune(r) ||
+		r == 0xB7 ||
+		r >= 0x300 && r <= 0x36F ||
+		r >= 0x203F && r <= 0x2040
+}
+
+// isName reports whether b matches the Name production.
+func isName(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	class := byte(nameStartChar)
+	for i := 0; i < len(b); {
+		c := b[i]
+		if c < utf8.RuneSelf {
+			if nameChars[c]&class == 0 {
+				return false
+			}
+			i++
+		} else {
+			r, n := utf8.DecodeRune(b[i:])
+			if class == nameStartChar && !isNameStartRune(r) || !isNameRune(r) {
+				return false
+			}
+			i += n
+		}
+		class = nameChar
+	}
+	return true
+}
+
+// indexInvalidChar returns the index of the first character in b that does
+// not match the Char production or is not valid UTF-8, or -1 if there is none.
+func indexInvalidChar(b []byte) int {
+	for i := 0; i < len(b); {
+		c := b[i]
+		if c < utf8.RuneSelf {
+			if c < 0x20 && c != '\t' && c != '\n' && c != '\r' {
+				return i
+			}
+			i++
+			continue
+		}
+		r, n := utf8.DecodeRune(b[i:])
+		if r == utf8.RuneError && n == 1 || !isXMLChar(r) {
+			return i
+		}
+		i += n
+	}
+	return -1
+}
+
+// checkTokenCharacters checks that all names of the decoded token match
+// the Name production and all of its data the Char production.
+func (thiz *decoder) checkTokenCharacters(t *Token) error {
+	switch t.Kind {
+	case TokenTypeStartElement:
+		err := thiz.checkName(t.Name)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(t.Attr); i++ {
+			err = thiz.checkName(t.Attr[i].Name)
+			if err != nil {
+				return err
+			}
+			err = thiz.checkChars(t.Attr[i].Value)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case TokenTypeEndElement:
+		return thiz.checkName(t.Name)
+	case TokenTypeProcInst:
+		err := thiz.checkName(t.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return thiz.checkChars(t.ByteData)
+}
+
+// checkName checks that both the prefix and the local part
+// of the given name match the Name production.
+func (thiz *decoder) checkName(name Name) error {
+	if !isName(name.Local) || name.Prefix != nil && !isName(name.Prefix) {
+		return thiz.syntaxError(ErrInvalidName, fmt.Sprintf("invalid name %q", name.String()))
+	}
+	return nil
+}
+
+// checkWhitespaceText checks the characters of text decoded by decodeText
+// which only consists of whitespace. decodeText keeps such text when
+// characters are checked, so that control characters in it are detected,
+// and checkWhitespaceText drops it afterwards. The text starts at index i
+// of bb if the input ended within it.
+func (thiz *decoder) checkWhitespaceText(t *Token, i int, cntn bool, err error) (bool, error) {
+	switch {
+	case err == io.EOF:
+		// the input may end with whitespace
+		checkErr := thiz.checkChars(thiz.bb[i:len(thiz.bb)])
+		if checkErr != nil {
+			return false, checkErr
+		}
+		return false, err
+	case err != nil || cntn:
+		return cntn, err
+	}
+	if thiz.preserveWhitespaces[thiz.top] || thiz.lossless || !isWhitespaces(t.ByteData) {
+		return false, nil
+	}
+	err = thiz.checkChars(t.ByteData)
+	if err != nil {
+		return false, err
+	}
+	thiz.bb = thiz.bb[:i]
+	return true, nil
+}
+
+// isSpace reports whether b matches the S production. Unlike isWhitespace,
+// it does not accept the other control characters.
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+// checkChars checks that b only consists of characters
+// matching the Char production.
+func (thiz *decoder) checkChars(b []byte) error {
+	i := indexInvalidChar(b)
+	if i < 0 {
+		return nil
+	}
+	r, n := utf8.DecodeRune(b[i:])
+	if r == utf8.RuneError && n == 1 {
+		if thiz.transcoded {
+			// marked by the transcoder
+			return thiz.syntaxError(ErrInvalidCharacter, "malformed input or character undefined in the encoding")
+		}
+		return thiz.syntaxError(ErrInvalidCharacter, "invalid UTF-8 sequence")
+	}
+	return thiz.syntaxError(ErrInvalidCharacter, fmt.Sprintf("invalid character %U", r))
+}
@@ -0,0 +1,108 @@
+package gosaxml_test
+
+import (
+	"github.com/HBTGmbH/gosaxml"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCharacterChecksValid(t *testing.T) {
+	for _, doc := range []string{
+		`<a/>`,
+		`<_a.b-c:d1 e_f="x" g:h.1="\t&#x1;"/>`,
+		`<äöü ñ="€"><日本語>テキスト</日本語></äöü>`,
+		"<a>\t\r\n \U0001F600 �</a>",
+		`<a·b x̀="1"/>`,
+		`<?pi-1 data?><a><![CDATA[x]]><!-- y --></a>`,
+		"<a\r\nb=\"1\"\tc=\"2\" >\n\t<d/> </a >\n",
+	} {
+		// when
+		_, err := decodeTokens(doc, gosaxml.WithCharacterChecks(), gosaxml.WithComments())
+
+		// then
+		assert.Nil(t, err, doc)
+	}
+}
+
+func TestCharacterChecksInvalid(t *testing.T) {
+	for name, tc := range map[string]struct {
+		doc      string
+		category error
+		opts     []gosaxml.DecoderOption
+	}{
+		"digit at start":            {`<1abc/>`, gosaxml.ErrInvalidName, nil},
+		"dash at start":             {`<-abc/>`, gosaxml.ErrInvalidName, nil},
+		"angle bracket":             {`<a<b/>`, gosaxml.ErrInvalidName, nil},
+		"control character in name": {"<a\x01b/>", gosaxml.ErrInvalidName, nil},
+		"empty prefix":              {`<:a/>`, gosaxml.ErrInvalidName, nil},
+		"invalid prefix":            {`<1:a/>`, gosaxml.ErrInvalidName, nil},
+		"attribute name":            {`<a 1b="1"/>`, gosaxml.ErrInvalidName, nil},
+		"end element name":          {`<a></1a>`, gosaxml.ErrInvalidName, nil},
+		"non-ASCII name start":      {`<·a/>`, gosaxml.ErrInvalidName, nil},
+		"non-ASCII name char":       {"<a×b/>", gosaxml.ErrInvalidName, nil},
+		"processing instruction":    {`<?1pi?>`, gosaxml.ErrInvalidName, nil},
+		"control character in text": {"<a>x\x01y</a>", gosaxml.ErrInvalidCharacter, nil},
+		"NUL in attribute value":    {"<a b=\"\x00\"/>", gosaxml.ErrInvalidCharacter, nil},
+		"invalid UTF-8":             {"<a>\xff</a>", gosaxml.ErrInvalidCharacter, nil},
+		"surrogate":                 {"<a>\xed\xa0\x80</a>", gosaxml.ErrInvalidCharacter, nil},
+		"non-character":             {"<a>￾</a>", gosaxml.ErrInvalidCharacter, nil},
+		"CDATA":                     {"<a><![CDATA[\x02]]></a>", gosaxml.ErrInvalidCharacter, nil},
+		"comment":                   {"<a><!--\x02--></a>", gosaxml.ErrInvalidCharacter, []gosaxml.DecoderOption{gosaxml.WithComments()}},
+		"control character as text": {"<a>\x01</a>", gosaxml.ErrInvalidCharacter, nil},
+		"NUL in whitespace text":    {"<a> \x00\n</a>", gosaxml.ErrInvalidCharacter, nil},
+		"control character at end":  {"<a/>\n\x01", gosaxml.ErrInvalidCharacter, nil},
+		"between attributes":        {"<a b=\"1\"\x01c=\"2\"/>", gosaxml.ErrInvalidCharacter, nil},
+		"before end of start":       {"<a b=\"1\"\x1f/>", gosaxml.ErrInvalidCharacter, nil},
+		"in end element":            {"<a></a \x01>", gosaxml.ErrInvalidCharacter, nil},
+		"end of PI":                 {"<?pi x\x01?><a/>", gosaxml.ErrInvalidCharacter, nil},
+	} {
+		// when
+		_, err := decodeTokens(tc.doc, append(tc.opts, gosaxml.WithCharacterChecks())...)
+		_, bytesErr := decodeAllTokens(gosaxml.NewBytesDecoder([]byte(tc.doc), append(tc.opts, gosaxml.WithCharacterChecks())...))
+
+		// then
+		t.Run(name, func(t *testing.T) {
+			assert.ErrorIs(t, err, tc.category)
+			assert.ErrorIs(t, bytesErr, tc.category)
+		})
+	}
+}
+
+func TestCharacterChecksErrorMessages(t *testing.T) {
+	for doc, msg := range map[string]string{
+		`<a><1b/></a>`:  `invalid name "1b" (line 1, column 7, offset 6, path /a/1b)`,
+		"<a>x\x01y</a>": "invalid character U+0001 (line 1, column 7, offset 6, path /a)",
+		"<a>x\xffy</a>": "invalid UTF-8 sequence (line 1, column 7, offset 6, path /a)",
+	} {
+		// when
+		_, err := decodeTokens(doc, gosaxml.WithCharacterChecks(), gosaxml.WithPositionTracking())
+
+		// then
+		assert.EqualError(t, err, msg)
+	}
+}
+
+func TestCharacterChecksDisabled(t *testing.T) {
+	// when
+	_, err := decodeTokens("<1a b=\"\x01\">\xff</1a>")
+
+	// then
+	assert.Nil(t, err)
+}
+
+func BenchmarkNextTokenCharacterChecks(b *testing.B) {
+	// given
+	doc := []byte(`<a b="1" c="22"><d>Hello, world!</d><e>Grüße</e><f/></a>`)
+	dec := gosaxml.NewBytesDecoder(doc, gosaxml.WithCharacterChecks())
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		var tk gosaxml.Token
+		dec.ResetBytes(doc)
+		for j := 0; j < 9; j++ {
+			assert.Nil(b, dec.NextToken(&tk))
+		}
+	}
+}
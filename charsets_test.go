@@ -0,0 +1,230 @@
+package gosaxml_test
+
+import (
+	"bytes"
+	"github.com/HBTGmbH/gosaxml"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecodeDeclaredCharsets(t *testing.T) {
+	for name, tc := range map[string]struct {
+		doc    string
+		tokens []string
+	}{
+		"ISO-8859-1": {
+			"<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><a b=\"\xe4\">Gr\xfc\xdfe</a>",
+			[]string{`3 xml version="1.0" encoding="ISO-8859-1"`, "1 a  b=ä", "5  Grüße", "2 a "},
+		},
+		"windows-1252 alias in single quotes": {
+			"<?xml version='1.0' encoding = 'CP1252' ?>\n<a>\x80 \x93x\x94</a>",
+			[]string{`3 xml version='1.0' encoding = 'CP1252'`, "1 a ", "5  € “x”", "2 a "},
+		},
+		"ISO-8859-5": {
+			"<?xml version=\"1.0\" encoding=\"iso-8859-5\"?><a>\xbf\xe0\xd8\xd2\xd5\xe2</a>",
+			[]string{`3 xml version="1.0" encoding="iso-8859-5"`, "1 a ", "5  Привет", "2 a "},
+		},
+		"US-ASCII": {
+			"<?xml version=\"1.0\" encoding=\"US-ASCII\"?><a>x</a>",
+			[]string{`3 xml version="1.0" encoding="US-ASCII"`, "1 a ", "5  x", "2 a "},
+		},
+		"UTF-16 already transcoded": {
+			"<?xml version=\"1.0\" encoding=\"utf-16\"?><a>x</a>",
+			[]string{`3 xml version="1.0" encoding="utf-16"`, "1 a ", "5  x", "2 a "},
+		},
+		"UTF-8": {
+			"<?xml version=\"1.0\" encoding=\"UTF-8\"?><a>\xc3\xa4</a>",
+			[]string{`3 xml version="1.0" encoding="UTF-8"`, "1 a ", "5  ä", "2 a "},
+		},
+	} {
+		// when
+		tokens, err := decodeTokens(tc.doc)
+		oneByteTokens, oneByteErr := decodeAllTokens(gosaxml.NewDecoder(iotest.OneByteReader(bytes.NewReader([]byte(tc.doc)))))
+		bytesTokens, bytesErr := decodeAllTokens(gosaxml.NewBytesDecoder([]byte(tc.doc)))
+
+		// then
+		t.Run(name, func(t *testing.T) {
+			assert.Nil(t, err)
+			assert.Nil(t, oneByteErr)
+			assert.Nil(t, bytesErr)
+			assert.Equal(t, tc.tokens, tokens)
+			assert.Equal(t, tc.tokens, oneByteTokens)
+			assert.Equal(t, tc.tokens, bytesTokens)
+		})
+	}
+}
+
+func TestDecodeUnsupportedCharset(t *testing.T) {
+	// given
+	doc := "<?xml version=\"1.0\" encoding=\"Shift_JIS\"?><a>x</a>"
+
+	// when
+	_, err := decodeTokens(doc)
+	_, bytesErr := decodeAllTokens(gosaxml.NewBytesDecoder([]byte(doc)))
+
+	// then
+	assert.ErrorIs(t, err, gosaxml.ErrInvalidDeclaration)
+	assert.ErrorIs(t, bytesErr, gosaxml.ErrInvalidDeclaration)
+}
+
+func TestDecodeWithCharset(t *testing.T) {
+	// given
+	doc := "<?xml version=\"1.0\" encoding=\"UTF-8\"?><a>\xa4</a>"
+	charset := gosaxml.LookupCharset("ISO-8859-15")
+
+	// when
+	tokens, err := decodeTokens(doc, gosaxml.WithCharset(charset))
+	bytesTokens, bytesErr := decodeAllTokens(gosaxml.NewBytesDecoder([]byte(doc), gosaxml.WithCharset(charset)))
+
+	// then
+	assert.Nil(t, err)
+	assert.Nil(t, bytesErr)
+	assert.Equal(t, []string{`3 xml version="1.0" encoding="UTF-8"`, "1 a ", "5  €", "2 a "}, tokens)
+	assert.Equal(t, tokens, bytesTokens)
+}
+
+func TestDecodeUndefinedCharsetByte(t *testing.T) {
+	// given
+	doc := "<?xml version=\"1.0\" encoding=\"windows-1252\"?><a b=\"1\">x\x81</a>"
+
+	// when
+	tokens, err := decodeTokens(doc)
+	_, checkedErr := decodeTokens(doc, gosaxml.WithCharacterChecks())
+	_, bytesErr := decodeAllTokens(gosaxml.NewBytesDecoder([]byte(doc), gosaxml.WithCharacterChecks()))
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "5  x\uFFFD", tokens[2])
+	assert.ErrorIs(t, checkedErr, gosaxml.ErrInvalidCharacter)
+	assert.ErrorIs(t, bytesErr, gosaxml.ErrInvalidCharacter)
+	var syntaxErr *gosaxml.SyntaxError
+	assert.ErrorAs(t, checkedErr, &syntaxErr)
+	assert.Equal(t, "malformed input or character undefined in the encoding", syntaxErr.Msg)
+	assert.Equal(t, "/a", syntaxErr.Path)
+}
+
+func TestDecodeCharsetLongDocument(t *testing.T) {
+	// given
+	text := bytes.Repeat([]byte("abc\xe4\xf6\xfc"), 1000)
+	doc := append([]byte("<?xml version=\"1.0\" encoding=\"latin1\"?><a>"), text...)
+	doc = append(doc, "</a>"...)
+
+	// when
+	tokens, err := decodeTokens(string(doc))
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "5  "+string(bytes.Repeat([]byte("abcäöü"), 1000)), tokens[2])
+}
+
+func TestLookupCharset(t *testing.T) {
+	for name, expected := range map[string]string{
+		"ISO-8859-1":   "ISO-8859-1",
+		"latin1":       "ISO-8859-1",
+		"Windows-1252": "windows-1252",
+		"cp1251":       "windows-1251",
+		"LATIN-9":      "ISO-8859-15",
+		"us-ascii":     "US-ASCII",
+	} {
+		// when
+		charset := gosaxml.LookupCharset(name)
+
+		// then
+		if assert.NotNil(t, charset, name) {
+			assert.Equal(t, expected, charset.Name())
+		}
+	}
+	assert.Nil(t, gosaxml.LookupCharset("UTF-8"))
+	assert.Nil(t, gosaxml.LookupCharset("Shift_JIS"))
+}
+
+func TestEncodeCharset(t *testing.T) {
+	// given
+	w := &bytes.Buffer{}
+	enc := gosaxml.NewEncoder(w)
+	enc.Charset = gosaxml.LookupCharset("ISO-8859-1")
+	tokens := []gosaxml.Token{
+		{Kind: gosaxml.TokenTypeStartElement, Name: gosaxml.Name{Local: []byte("grüße")}, Attr: []gosaxml.Attr{
+			{Name: gosaxml.Name{Local: []byte("a")}, Value: []byte("ä€")},
+		}},
+		{Kind: gosaxml.TokenTypeTextElement, ByteData: []byte("Grüße, 世界")},
+		{Kind: gosaxml.TokenTypeCharData, ByteData: []byte("ä€]]>€")},
+		{Kind: gosaxml.TokenTypeComment, ByteData: []byte(" ä ")},
+		{Kind: gosaxml.TokenTypeEndElement, Name: gosaxml.Name{Local: []byte("grüße")}},
+	}
+
+	// when
+	for i := range tokens {
+		assert.Nil(t, enc.EncodeToken(&tokens[i]))
+	}
+	assert.Nil(t, enc.Flush())
+
+	// then
+	assert.Equal(t, "<gr\xfc\xdfe a=\"\xe4&#8364;\">Gr\xfc\xdfe, &#19990;&#30028;"+
+		"<![CDATA[\xe4]]>&#8364;<![CDATA[]]]]><![CDATA[>]]>&#8364;<![CDATA[]]>"+
+		"<!-- \xe4 --></gr\xfc\xdfe>", w.String())
+}
+
+func TestEncodeCharsetEscaped(t *testing.T) {
+	// given
+	w := &bytes.Buffer{}
+	enc := gosaxml.NewEncoder(w)
+	enc.Charset = gosaxml.LookupCharset("US-ASCII")
+	enc.Escape = true
+	tokens := []gosaxml.Token{
+		{Kind: gosaxml.TokenTypeStartElement, Name: gosaxml.Name{Local: []byte("a")}, Attr: []gosaxml.Attr{
+			{Name: gosaxml.Name{Local: []byte("b")}, Value: []byte("<ä>")},
+		}},
+		{Kind: gosaxml.TokenTypeTextElement, ByteData: []byte("x & ü")},
+		{Kind: gosaxml.TokenTypeEndElement, Name: gosaxml.Name{Local: []byte("a")}},
+	}
+
+	// when
+	for i := range tokens {
+		assert.Nil(t, enc.EncodeToken(&tokens[i]))
+	}
+	assert.Nil(t, enc.Flush())
+
+	// then
+	assert.Equal(t, `<a b="&lt;&#228;>">x &amp; &#252;</a>`, w.String())
+}
+
+func TestEncodeCharsetUnmappable(t *testing.T) {
+	for name, tk := range map[string]gosaxml.Token{
+		"element name":           {Kind: gosaxml.TokenTypeStartElement, Name: gosaxml.Name{Local: []byte("世界")}},
+		"attribute name":         {Kind: gosaxml.TokenTypeStartElement, Name: gosaxml.Name{Local: []byte("a")}, Attr: []gosaxml.Attr{{Name: gosaxml.Name{Local: []byte("€")}}}},
+		"comment":                {Kind: gosaxml.TokenTypeComment, ByteData: []byte("€")},
+		"processing instruction": {Kind: gosaxml.TokenTypeProcInst, Name: gosaxml.Name{Local: []byte("pi")}, ByteData: []byte("€")},
+		"directive":              {Kind: gosaxml.TokenTypeDirective, ByteData: []byte("DOCTYPE €")},
+	} {
+		// given
+		enc := gosaxml.NewEncoder(&bytes.Buffer{})
+		enc.Charset = gosaxml.LookupCharset("ISO-8859-1")
+
+		// when
+		err := enc.EncodeToken(&tk)
+
+		// then
+		t.Run(name, func(t *testing.T) {
+			assert.ErrorIs(t, err, gosaxml.ErrUnmappableCharacter)
+		})
+	}
+}
+
+func TestCharsetRoundTrip(t *testing.T) {
+	// given
+	doc := "<?xml version=\"1.0\" encoding=\"windows-1252\"?>\n<a b=\"\x80\">\n  <c>\xe4\x96\xfc</c>\n</a>"
+	dec := gosaxml.NewDecoder(bytes.NewReader([]byte(doc)), gosaxml.WithLossless())
+	w := &bytes.Buffer{}
+	enc := gosaxml.NewEncoder(w)
+	enc.Lossless = true
+	enc.Charset = gosaxml.LookupCharset("windows-1252")
+	var tk gosaxml.Token
+
+	// when
+	decodeEncode(t, dec, enc, &tk)
+
+	// then
+	assert.Equal(t, doc, w.String())
+}
@@ -395,6 +395,52 @@ func TestProcInst(t *testing.T) {
 		"<a:a xmlns:a=\"http://ns1\" a:attr1=\"val1\"/>", w.String())
 }
 
+func TestCDATA(t *testing.T) {
+	// given
+	input := `<a><![CDATA[x]]]]><![CDATA[>y <z/>]]></a>`
+	dec := gosaxml.NewDecoder(strings.NewReader(input))
+	w := &bytes.Buffer{}
+	enc := gosaxml.NewEncoder(w)
+	var tk gosaxml.Token
+
+	// when
+	decodeEncode(t, dec, enc, &tk)
+
+	// then
+	assert.Equal(t, input, w.String())
+}
+
+func TestDoctype(t *testing.T) {
+	// given
+	input := `<!DOCTYPE html [<!ENTITY nbsp "&#160;">]><html><p/></html>`
+	dec := gosaxml.NewDecoder(strings.NewReader(input))
+	w := &bytes.Buffer{}
+	enc := gosaxml.NewEncoder(w)
+	var tk gosaxml.Token
+
+	// when
+	decodeEncode(t, dec, enc, &tk)
+
+	// then
+	assert.Equal(t, input, w.String())
+}
+
+func TestEntityDecodingAndEscaping(t *testing.T) {
+	// given
+	input := `<a b="&lt;&#x9;&quot;" c='&apos;'>&amp;&#x20AC;&#13;</a>`
+	dec := gosaxml.NewDecoder(strings.NewReader(input), gosaxml.WithEntityDecoding())
+	w := &bytes.Buffer{}
+	enc := gosaxml.NewEncoder(w)
+	enc.Escape = true
+	var tk gosaxml.Token
+
+	// when
+	decodeEncode(t, dec, enc, &tk)
+
+	// then
+	assert.Equal(t, `<a b="&lt;&#x9;&quot;" c='&apos;'>&amp;€&#xD;</a>`, w.String())
+}
+
 func TestPreserveWhitespace(t *testing.T) {
 	// given
 	input := `
@@ -533,3 +579,76 @@ func decodeEncode(t *testing.T, dec gosaxml.Decoder, enc *gosaxml.Encoder, tk *g
 	}
 	assert.Nil(t, enc.Flush())
 }
+
+func TestLosslessRoundTrip(t *testing.T) {
+	input := `<?xml version="1.0" encoding="UTF-8" ?>
+<!-- configuration -->
+<!DOCTYPE config>
+<config  version = '2'
+         xmlns="urn:config" >
+	<empty></empty>
+	<selfClosing />
+	<?pi   some  data  ?>
+	<entry key="a&amp;b"	value='1'/>
+	<![CDATA[ raw ]]>
+	<text> keep   this </text >
+</config>
+`
+	for name, dec := range map[string]gosaxml.Decoder{
+		"reader": gosaxml.NewDecoder(strings.NewReader(input), gosaxml.WithLossless()),
+		"bytes":  gosaxml.NewBytesDecoder([]byte(input), gosaxml.WithLossless()),
+	} {
+		// given
+		w := &bytes.Buffer{}
+		enc := gosaxml.NewEncoder(w)
+		enc.Lossless = true
+		var tk gosaxml.Token
+
+		// when
+		decodeEncode(t, dec, enc, &tk)
+
+		// then
+		assert.Equal(t, input, w.String(), name)
+	}
+}
+
+func TestLosslessEncodingOfNewTokens(t *testing.T) {
+	// given
+	w := &bytes.Buffer{}
+	enc := gosaxml.NewEncoder(w)
+	enc.Lossless = true
+	start := startElementWithAttr("a", "b", "c")
+	end := gosaxml.Token{Kind: gosaxml.TokenTypeEndElement, Name: start.Name}
+	pi := gosaxml.Token{Kind: gosaxml.TokenTypeProcInst, Name: gosaxml.Name{Local: []byte("pi")}, ByteData: []byte("data")}
+
+	// when
+	assert.Nil(t, enc.EncodeToken(&pi))
+	assert.Nil(t, enc.EncodeToken(&start))
+	assert.Nil(t, enc.EncodeToken(&end))
+	assert.Nil(t, enc.Flush())
+
+	// then
+	assert.Equal(t, `<?pi data?><a b="c"></a>`, w.String())
+}
+
+func TestEmptyElementStyle(t *testing.T) {
+	input := `<r><a/><b></b><c x="1" /></r>`
+	for style, expected := range map[gosaxml.EmptyElementStyle]string{
+		gosaxml.EmptyElementCollapse: `<r><a/><b/><c x="1"/></r>`,
+		gosaxml.EmptyElementExpand:   `<r><a></a><b></b><c x="1"></c></r>`,
+		gosaxml.EmptyElementPreserve: `<r><a/><b></b><c x="1"/></r>`,
+	} {
+		// given
+		dec := gosaxml.NewDecoder(strings.NewReader(input))
+		w := &bytes.Buffer{}
+		enc := gosaxml.NewEncoder(w)
+		enc.EmptyElementStyle = style
+		var tk gosaxml.Token
+
+		// when
+		decodeEncode(t, dec, enc, &tk)
+
+		// then
+		assert.Equal(t, expected, w.String())
+	}
+}
@@ -77,9 +77,71 @@ func TestDeepNesting(t *testing.T) {
 	assert.Equal(t, 510, len(tokens))
 }
 
+func TestDeeperNestingThan256(t *testing.T) {
+	tokens, err := collectTokens(t, nestedDocument(1000))
+	assert.Nil(t, err)
+	assert.Equal(t, 2000, len(tokens))
+}
+
+func TestDeepNestingRoundTrip(t *testing.T) {
+	input := nestedDocument(1000)
+	out, err := roundTrip(t, input)
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Replace(input, "<e999></e999>", "<e999/>", 1), out)
+}
+
 func TestNestingDepthLimit(t *testing.T) {
-	_, err := collectTokens(t, nestedDocument(256))
-	assert.EqualError(t, err, "element nesting depth exceeds 255")
+	_, err := collectTokens(t, nestedDocument(gosaxml.DefaultMaxDepth+1))
+	assertSyntaxError(t, err, gosaxml.ErrNestingTooDeep, fmt.Sprintf("element nesting depth exceeds %d", gosaxml.DefaultMaxDepth))
+}
+
+func TestConfiguredNestingDepthLimit(t *testing.T) {
+	dec := gosaxml.NewDecoder(strings.NewReader(nestedDocument(11)), gosaxml.WithMaxDepth(10))
+	var tk gosaxml.Token
+	var err error
+	for err == nil {
+		err = dec.NextToken(&tk)
+	}
+	assertSyntaxError(t, err, gosaxml.ErrNestingTooDeep, "element nesting depth exceeds 10")
+}
+
+func TestZeroMaxDepthMeansDefault(t *testing.T) {
+	for _, maxDepth := range []int{0, -1} {
+		// given
+		nm := gosaxml.NewNamespaceModifier()
+		nm.MaxDepth = maxDepth
+		enc := gosaxml.NewEncoder(io.Discard, nm)
+		dec := gosaxml.NewDecoder(strings.NewReader(nestedDocument(100)), gosaxml.WithMaxDepth(maxDepth))
+		var tk gosaxml.Token
+
+		// when
+		var err error
+		for err == nil {
+			err = dec.NextToken(&tk)
+			if err == nil {
+				err = enc.EncodeToken(&tk)
+			}
+		}
+
+		// then
+		assert.Equal(t, io.EOF, err)
+	}
+}
+
+func TestNamespaceModifierNestingDepthLimit(t *testing.T) {
+	nm := gosaxml.NewNamespaceModifier()
+	nm.MaxDepth = 10
+	enc := gosaxml.NewEncoder(io.Discard, nm)
+	dec := gosaxml.NewDecoder(strings.NewReader(nestedDocument(11)))
+	var tk gosaxml.Token
+	var err error
+	for err == nil {
+		err = dec.NextToken(&tk)
+		if err == nil {
+			err = enc.EncodeToken(&tk)
+		}
+	}
+	assert.EqualError(t, err, "element nesting depth exceeds 10")
 }
 
 func TestMoreThan256Attributes(t *testing.T) {
@@ -200,7 +262,7 @@ func TestUnprefixedAttributeStaysUnprefixed(t *testing.T) {
 
 func TestUnmatchedEndElement(t *testing.T) {
 	_, err := collectTokens(t, "</a>")
-	assert.EqualError(t, err, "unexpected end element without matching start element")
+	assertSyntaxError(t, err, gosaxml.ErrUnexpectedEndElement, "unexpected end element without matching start element")
 }
 
 func TestRetryAfterErrorDoesNotPanic(t *testing.T) {
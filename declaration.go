@@ -0,0 +1,193 @@
+package gosaxml
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Declaration is the XML declaration of a document
+// (https://www.w3.org/TR/xml/#NT-XMLDecl), like
+// <?xml version="1.0" encoding="UTF-8" standalone="yes"?>.
+type Declaration struct {
+	// Version is the XML version, like "1.0".
+	Version []byte
+
+	// Encoding is the declared character encoding,
+	// like "UTF-8", or nil if there is none.
+	Encoding []byte
+
+	// Standalone is "yes" or "no", or nil if there is none.
+	Standalone []byte
+}
+
+var (
+	bsversion    = []byte("version")
+	bsversion10  = []byte("1.0")
+	bsstandalone = []byte("standalone")
+	bsyes        = []byte("yes")
+	bsno         = []byte("no")
+)
+
+// isVersionNum reports whether v matches the VersionNum production "1.[0-9]+".
+func isVersionNum(v []byte) bool {
+	if len(v) < 3 || v[0] != '1' || v[1] != '.' {
+		return false
+	}
+	for _, b := range v[2:] {
+		if b < '0' || b > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// isEncName reports whether v matches the EncName production
+// "[A-Za-z] ([A-Za-z0-9._] | '-')*".
+func isEncName(v []byte) bool {
+	if len(v) == 0 || !isASCIILetter(v[0]) {
+		return false
+	}
+	for _, b := range v[1:] {
+		if !isASCIILetter(b) && (b < '0' || b > '9') && b != '.' && b != '_' && b != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+func isASCIILetter(b byte) bool {
+	return b|0x20 >= 'a' && b|0x20 <= 'z'
+}
+
+// isStandalone reports whether v is a valid value
+// of the standalone pseudo-attribute.
+func isStandalone(v []byte) bool {
+	return bytes.Equal(v, bsyes) || bytes.Equal(v, bsno)
+}
+
+// parseDeclaration parses the data of an XML declaration following its
+// "<?xml" target. If it is malformed, a description of the error is returned.
+func parseDeclaration(data []byte) (Declaration, string) {
+	var d Declaration
+	var attr Attr
+	it := PseudoAttrIterator{data: data}
+	for it.Next(&attr) {
+		name, value := attr.Name.Local, attr.Value
+		switch {
+		case d.Version == nil && bytes.Equal(name, bsversion):
+			if !isVersionNum(value) {
+				return d, fmt.Sprintf("invalid XML declaration: invalid version %q", value)
+			}
+			d.Version = value
+		case d.Version != nil && d.Encoding == nil && d.Standalone == nil && bytes.Equal(name, bsencoding):
+			if !isEncName(value) {
+				return d, fmt.Sprintf("invalid XML declaration: invalid encoding %q", value)
+			}
+			d.Encoding = value
+		case d.Version != nil && d.Standalone == nil && bytes.Equal(name, bsstandalone):
+			if !isStandalone(value) {
+				return d, fmt.Sprintf("invalid XML declaration: invalid standalone %q", value)
+			}
+			d.Standalone = value
+		default:
+			return d, fmt.Sprintf("invalid XML declaration: unexpected pseudo-attribute %s", name)
+		}
+	}
+	if it.msg != "" {
+		return d, "invalid XML declaration: " + it.msg
+	}
+	if d.Version == nil {
+		return d, "invalid XML declaration: missing version"
+	}
+	return d, ""
+}
+
+// decodeDeclaration checks the position of the XML declaration t
+// and parses it.
+func (thiz *decoder) decodeDeclaration(t *Token) error {
+	if thiz.tokStart != thiz.docStart {
+		return thiz.syntaxError(ErrMisplacedContent, "XML declaration not at the start of the input")
+	}
+	// the token data is only valid until the next call of NextToken
+	thiz.declBuf = append(thiz.declBuf[:0], t.ByteData...)
+	decl, msg := parseDeclaration(thiz.declBuf)
+	if msg != "" {
+		return thiz.syntaxError(ErrInvalidDeclaration, msg)
+	}
+	if thiz.charset == nil && decl.Encoding != nil && !isSupportedEncoding(decl.Encoding) {
+		return thiz.syntaxError(ErrInvalidDeclaration, fmt.Sprintf("invalid XML declaration: unsupported encoding %q", decl.Encoding))
+	}
+	thiz.decl = decl
+	thiz.hasDecl = true
+	return nil
+}
+
+func (thiz *decoder) Declaration() (Declaration, bool) {
+	return thiz.decl, thiz.hasDecl
+}
+
+// EncodeDeclaration writes the XML declaration d, which must be done before
+// any Token is encoded. An empty Version defaults to "1.0" and an empty
+// Encoding to the name of the Charset of the Encoder, if any.
+func (thiz *Encoder) EncodeDeclaration(d *Declaration) error {
+	if thiz.started {
+		return fmt.Errorf("%w: the XML declaration must be encoded first", ErrInvalidDeclaration)
+	}
+	version := d.Version
+	if len(version) == 0 {
+		version = bsversion10
+	}
+	if !isVersionNum(version) {
+		return fmt.Errorf("%w: invalid version %q", ErrInvalidDeclaration, version)
+	}
+	encoding := d.Encoding
+	if len(encoding) == 0 && thiz.Charset != nil {
+		encoding = thiz.Charset.aliases[0]
+	}
+	if len(encoding) > 0 && !isEncName(encoding) {
+		return fmt.Errorf("%w: invalid encoding %q", ErrInvalidDeclaration, encoding)
+	}
+	if len(d.Standalone) > 0 && !isStandalone(d.Standalone) {
+		return fmt.Errorf("%w: invalid standalone %q", ErrInvalidDeclaration, d.Standalone)
+	}
+	thiz.started = true
+	err := thiz.writeBytes(bsXMLDeclStart)
+	if err != nil {
+		return err
+	}
+	err = thiz.writePseudoAttr(bsversion, version)
+	if err != nil {
+		return err
+	}
+	if len(encoding) > 0 {
+		err = thiz.writePseudoAttr(bsencoding, encoding)
+		if err != nil {
+			return err
+		}
+	}
+	if len(d.Standalone) > 0 {
+		err = thiz.writePseudoAttr(bsstandalone, d.Standalone)
+		if err != nil {
+			return err
+		}
+	}
+	return thiz.writeBytes(questAngleClose)
+}
+
+// writePseudoAttr writes the pseudo-attribute name="value"
+// preceded by a space.
+func (thiz *Encoder) writePseudoAttr(name, value []byte) error {
+	err := thiz.write(' ')
+	if err != nil {
+		return err
+	}
+	err = thiz.writeBytes(name)
+	if err != nil {
+		return err
+	}
+	err = thiz.write('=')
+	if err != nil {
+		return err
+	}
+	return thiz.writeString(value, false)
+}
@@ -0,0 +1,175 @@
+package gosaxml_test
+
+import (
+	"bytes"
+	"github.com/HBTGmbH/gosaxml"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestDecodeDeclaration(t *testing.T) {
+	for doc, expected := range map[string]gosaxml.Declaration{
+		`<?xml version="1.0"?><a/>`: {Version: []byte("1.0")},
+		`<?xml version="1.1" encoding="UTF-8" standalone="yes"?><a/>`: {
+			Version: []byte("1.1"), Encoding: []byte("UTF-8"), Standalone: []byte("yes"),
+		},
+		"<?xml version = '1.0'\n\tstandalone='no' ?><a/>": {Version: []byte("1.0"), Standalone: []byte("no")},
+		"\n  <?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><a/>": {
+			Version: []byte("1.0"), Encoding: []byte("ISO-8859-1"),
+		},
+	} {
+		for _, lossless := range []bool{false, true} {
+			// given
+			var opts []gosaxml.DecoderOption
+			if lossless {
+				opts = append(opts, gosaxml.WithLossless())
+			}
+			dec := gosaxml.NewDecoder(strings.NewReader(doc), opts...)
+			var tk gosaxml.Token
+
+			// when
+			_, before := dec.Declaration()
+			err := dec.NextToken(&tk)
+			for err == nil && tk.Kind != gosaxml.TokenTypeProcInst {
+				err = dec.NextToken(&tk)
+			}
+			assert.Nil(t, dec.NextToken(&tk))
+			decl, after := dec.Declaration()
+
+			// then
+			assert.Nil(t, err, doc)
+			assert.False(t, before, doc)
+			assert.True(t, after, doc)
+			assert.Equal(t, expected, decl, doc)
+		}
+	}
+}
+
+func TestDecodeWithoutDeclaration(t *testing.T) {
+	// given
+	dec := gosaxml.NewDecoder(strings.NewReader(`<?xml version="1.0"?><a/>`))
+	_, err1 := decodeAllTokens(dec)
+
+	// when
+	dec.Reset(strings.NewReader(`<?xml-stylesheet href="a.xsl"?><a/>`))
+	_, err2 := decodeAllTokens(dec)
+	_, ok := dec.Declaration()
+
+	// then
+	assert.Nil(t, err1)
+	assert.Nil(t, err2)
+	assert.False(t, ok)
+}
+
+func TestDecodeInvalidDeclaration(t *testing.T) {
+	for name, tc := range map[string]struct {
+		doc      string
+		category error
+		opts     []gosaxml.DecoderOption
+	}{
+		"after root element":    {`<a/><?xml version="1.0"?>`, gosaxml.ErrMisplacedContent, nil},
+		"within root element":   {`<a><?xml version="1.0"?></a>`, gosaxml.ErrMisplacedContent, nil},
+		"after comment":         {`<!-- c --><?xml version="1.0"?><a/>`, gosaxml.ErrMisplacedContent, nil},
+		"after text":            {`x<?xml version="1.0"?><a/>`, gosaxml.ErrMisplacedContent, nil},
+		"twice":                 {`<?xml version="1.0"?><?xml version="1.0"?><a/>`, gosaxml.ErrMisplacedContent, nil},
+		"after space in strict": {` <?xml version="1.0"?><a/>`, gosaxml.ErrMisplacedContent, []gosaxml.DecoderOption{gosaxml.WithStrict()}},
+		"missing version":       {`<?xml encoding="UTF-8"?><a/>`, gosaxml.ErrInvalidDeclaration, nil},
+		"empty":                 {`<?xml ?><a/>`, gosaxml.ErrInvalidDeclaration, nil},
+		"invalid version":       {`<?xml version="2.0"?><a/>`, gosaxml.ErrInvalidDeclaration, nil},
+		"invalid encoding":      {`<?xml version="1.0" encoding="8bit"?><a/>`, gosaxml.ErrInvalidDeclaration, nil},
+		"invalid standalone":    {`<?xml version="1.0" standalone="true"?><a/>`, gosaxml.ErrInvalidDeclaration, nil},
+		"wrong order":           {`<?xml version="1.0" standalone="yes" encoding="UTF-8"?><a/>`, gosaxml.ErrInvalidDeclaration, nil},
+		"unknown":               {`<?xml version="1.0" foo="bar"?><a/>`, gosaxml.ErrInvalidDeclaration, nil},
+		"duplicate":             {`<?xml version="1.0" version="1.0"?><a/>`, gosaxml.ErrInvalidDeclaration, nil},
+		"missing whitespace":    {`<?xml version="1.0"encoding="UTF-8"?><a/>`, gosaxml.ErrInvalidDeclaration, nil},
+		"missing quote":         {`<?xml version="1.0?><a/>`, gosaxml.ErrInvalidDeclaration, nil},
+		"missing value":         {`<?xml version?><a/>`, gosaxml.ErrInvalidDeclaration, nil},
+	} {
+		// when
+		_, err := decodeTokens(tc.doc, tc.opts...)
+		_, bytesErr := decodeAllTokens(gosaxml.NewBytesDecoder([]byte(tc.doc), tc.opts...))
+
+		// then
+		t.Run(name, func(t *testing.T) {
+			assert.ErrorIs(t, err, tc.category)
+			assert.ErrorIs(t, bytesErr, tc.category)
+		})
+	}
+}
+
+func TestDecodeDeclarationAfterBOM(t *testing.T) {
+	// given
+	doc := "\uFEFF<?xml version=\"1.0\"?><a/>"
+
+	// when
+	_, err := decodeTokens(doc, gosaxml.WithStrict())
+	_, bytesErr := decodeAllTokens(gosaxml.NewBytesDecoder([]byte(doc), gosaxml.WithStrict()))
+
+	// then
+	assert.Nil(t, err)
+	assert.Nil(t, bytesErr)
+}
+
+func TestEncodeDeclaration(t *testing.T) {
+	for expected, tc := range map[string]struct {
+		decl    gosaxml.Declaration
+		charset string
+	}{
+		`<?xml version="1.0"?><a/>`: {},
+		`<?xml version="1.1" encoding="UTF-8" standalone="yes"?><a/>`: {
+			decl: gosaxml.Declaration{Version: []byte("1.1"), Encoding: []byte("UTF-8"), Standalone: []byte("yes")},
+		},
+		`<?xml version="1.0" encoding="windows-1252"?><a/>`: {charset: "cp1252"},
+	} {
+		// given
+		w := &bytes.Buffer{}
+		enc := gosaxml.NewEncoder(w)
+		enc.Charset = gosaxml.LookupCharset(tc.charset)
+		tk := gosaxml.Token{Kind: gosaxml.TokenTypeStartElement, Name: gosaxml.Name{Local: []byte("a")}}
+		end := gosaxml.Token{Kind: gosaxml.TokenTypeEndElement, Name: gosaxml.Name{Local: []byte("a")}}
+
+		// when
+		err := enc.EncodeDeclaration(&tc.decl)
+		assert.Nil(t, enc.EncodeToken(&tk))
+		assert.Nil(t, enc.EncodeToken(&end))
+		assert.Nil(t, enc.Flush())
+
+		// then
+		assert.Nil(t, err)
+		assert.Equal(t, expected, w.String())
+	}
+}
+
+func TestEncodeInvalidDeclaration(t *testing.T) {
+	for name, decl := range map[string]gosaxml.Declaration{
+		"version":    {Version: []byte("2.0")},
+		"encoding":   {Encoding: []byte("UTF 8")},
+		"standalone": {Standalone: []byte("maybe")},
+	} {
+		// given
+		w := &bytes.Buffer{}
+		enc := gosaxml.NewEncoder(w)
+
+		// when
+		err := enc.EncodeDeclaration(&decl)
+
+		// then
+		assert.ErrorIs(t, err, gosaxml.ErrInvalidDeclaration, name)
+		assert.Nil(t, enc.Flush())
+		assert.Empty(t, w.String(), name)
+	}
+}
+
+func TestEncodeDeclarationAfterToken(t *testing.T) {
+	// given
+	enc := gosaxml.NewEncoder(&bytes.Buffer{})
+	tk := gosaxml.Token{Kind: gosaxml.TokenTypeComment, ByteData: []byte("c")}
+	assert.Nil(t, enc.EncodeToken(&tk))
+
+	// when
+	err := enc.EncodeDeclaration(&gosaxml.Declaration{})
+
+	// then
+	assert.ErrorIs(t, err, gosaxml.ErrInvalidDeclaration)
+}
@@ -2,12 +2,17 @@ package gosaxml
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"io"
 )
 
 // Decoder decodes an XML input stream into Token values.
+// The input may be encoded in UTF-8, UTF-16 or UTF-32, which is detected
+// from its byte order mark or its first character (see
+// https://www.w3.org/TR/xml/#sec-guessing), or in one of the single-byte
+// character sets of LookupCharset given by the encoding declaration or
+// WithCharset. Input not encoded in UTF-8 is transcoded to UTF-8, to which
+// all offsets then refer. A byte order mark is never decoded as text.
 type Decoder interface {
 	// NextToken decodes and stores the next Token into
 	// the provided Token pointer.
@@ -17,64 +22,365 @@ type Decoder interface {
 	// and then only read/touch the fields relevant for that kind.
 	NextToken(t *Token) error
 
+	// Skip skips the remaining content of the innermost open element up to
+	// and including its end element, without decoding any tokens for it.
+	// When called directly after NextToken returned a TokenTypeStartElement,
+	// this skips that element's entire subtree.
+	Skip() error
+
+	// WriteOuterXML writes the verbatim bytes of the start element most
+	// recently returned by NextToken, of its content and of its matching
+	// end element to w, skipping them like Skip. It must be called directly
+	// after NextToken returned a TokenTypeStartElement and returns
+	// ErrNotAtStartElement otherwise.
+	WriteOuterXML(w io.Writer) error
+
 	// InputOffset returns the current offset in the input stream.
 	InputOffset() int
 
+	// TokenOffsets returns the input offsets of the first byte of the
+	// most recently decoded Token and of the byte following its last byte,
+	// so that input[start:end] is the verbatim source of the Token.
+	// The range of a self-closing start element includes the "/>".
+	// Its accompanying end element has an empty range at the offset
+	// following the "/>".
+	TokenOffsets() (start, end int)
+
+	// Declaration returns the XML declaration at the start of the input
+	// and whether there is one, once it has been decoded by NextToken.
+	// A misplaced or malformed declaration results in a SyntaxError of the
+	// categories ErrMisplacedContent or ErrInvalidDeclaration.
+	Declaration() (Declaration, bool)
+
+	// Position returns the position of the first byte of the most
+	// recently decoded Token. It is only tracked when the Decoder
+	// was created with WithPositionTracking; otherwise the zero
+	// Position is returned.
+	Position() Position
+
 	// Reset resets the Decoder to the given io.Reader.
 	Reset(r io.Reader)
+
+	// ResetBytes resets the Decoder to decode the given byte slice
+	// without copying, like a Decoder created by NewBytesDecoder.
+	ResetBytes(in []byte)
 }
 
 type decoder struct {
-	rb                  [2048]byte
-	bbOffset            [256]int32
-	numAttributes       [256]int32
-	lastOpen            Name
-	preserveWhitespaces [256]bool
+	rb                  []byte
+	buf                 []byte
+	input               []byte
+	capture             io.Writer
+	bbOffset            []int32
+	numAttributes       []int32
+	names               []Name
+	nsOffs              []int32
+	nsBindings          [][]byte
+	prefixes            prefixIndex
+	attrNames           pairSet
+	nsChecker           namespaceChecker
+	preserveWhitespaces []bool
 	rd                  io.Reader
+	transcoder          *transcoder
+	transcoded          bool
+	charset             *Charset
+	decl                Declaration
+	hasDecl             bool
+	declBuf             []byte
+	docStart            int
 	bb                  []byte
 	attrs               []Attr
 	r                   int
 	w                   int
 	off                 int
-	top                 byte
+	mark                int
+	captureR            int
+	line                int
+	lineStart           int
+	lineR               int
+	pos                 Position
+	tokStart            int
+	tokEnd              int
+	trackPositions      bool
+	checks              bool
+	plainText           bool
+	top                 int
+	maxDepth            int
 	lastStartElement    bool
+	comments            bool
+	entities            bool
+	namespaces          bool
+	checkNamespaces     bool
+	strict              bool
+	checkCharacters     bool
+	root                bool
+	betweenTokens       bool
+	lossless            bool
+	limited             bool
+	limits              Limits
+	tokens              int
+	valueStart          int
+	valueLimit          int
+	valueErr            error
+	zeroCopy            bool
+	tail                bool
+	sniff               bool
 }
 
+// DefaultReadBufferSize is the default size of the read buffer of a Decoder.
+const DefaultReadBufferSize = 2048
+
+// MinReadBufferSize is the smallest read buffer size accepted by
+// WithReadBufferSize. Smaller sizes are rounded up to it.
+const MinReadBufferSize = 64
+
+// DefaultMaxDepth is the default maximum element nesting depth
+// of a Decoder and a NamespaceModifier.
+const DefaultMaxDepth = 10000
+
 var (
-	bsxml      = []byte("xml")
-	bsspace    = []byte("space")
-	bspreserve = []byte("preserve")
-	simdWidth  int
+	bsxml              = []byte("xml")
+	bsspace            = []byte("space")
+	bspreserve         = []byte("preserve")
+	bsnewline          = []byte("\n")
+	bsCDATA            = []byte("CDATA[")
+	bsDOCTYPE          = []byte("DOCTYPE")
+	bsOpenAngleBracket = []byte("<")
+	simdWidth          int
 )
 
-// NewDecoder creates a new Decoder.
-func NewDecoder(r io.Reader) Decoder {
-	return &decoder{
-		rd:    r,
-		bb:    make([]byte, 0, 256),
-		attrs: make([]Attr, 0, 256),
+// NewDecoder creates a new Decoder configured with the given options.
+func NewDecoder(r io.Reader, opts ...DecoderOption) Decoder {
+	// keep this inlineable so that calls through the returned
+	// interface can be devirtualized by the compiler
+	return createDecoder(r, opts)
+}
+
+// NewBytesDecoder creates a new Decoder configured with the given options
+// which decodes the given byte slice without copying it: the Name, Attr and
+// ByteData of decoded tokens are subslices of the input wherever possible
+// and only copied when they need to be transformed (like by entity decoding).
+// The input must not be modified while it is being decoded.
+func NewBytesDecoder(in []byte, opts ...DecoderOption) Decoder {
+	return createBytesDecoder(in, opts)
+}
+
+func createBytesDecoder(in []byte, opts []DecoderOption) *decoder {
+	d := createDecoder(nil, opts)
+	d.ResetBytes(in)
+	return d
+}
+
+func createDecoder(r io.Reader, opts []DecoderOption) *decoder {
+	d := &decoder{
+		rd:                  r,
+		bbOffset:            make([]int32, 256),
+		names:               make([]Name, 256),
+		nsOffs:              make([]int32, 256),
+		numAttributes:       make([]int32, 256),
+		preserveWhitespaces: make([]bool, 256),
+		maxDepth:            DefaultMaxDepth,
+		mark:                -1,
+		sniff:               true,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	// keep the per-token work of the default configuration minimal
+	d.checks = d.strict || d.checkCharacters || d.limited || d.trackPositions
+	d.plainText = !d.checks && !d.entities && !d.lossless
+	// The read buffer is padded with simdWidth bytes which are never
+	// filled, so that vector loads at the end of the buffer stay in bounds.
+	if d.buf == nil {
+		d.buf = make([]byte, DefaultReadBufferSize+simdWidth)
+	}
+	d.rb = d.buf
+	if d.bb == nil {
+		d.bb = make([]byte, 0, 256)
 	}
+	if d.attrs == nil {
+		d.attrs = make([]Attr, 0, 256)
+	}
+	return d
 }
 
 func isWhitespace(b byte) bool {
 	return b <= ' '
 }
 
+// isWhitespaces reports whether b only consists of whitespace.
+func isWhitespaces(b []byte) bool {
+	for _, c := range b {
+		if !isWhitespace(c) {
+			return false
+		}
+	}
+	return true
+}
+
 func (thiz *decoder) read0() error {
-	if thiz.r > 0 {
-		copy(thiz.rb[:], thiz.rb[thiz.r:thiz.w])
-		thiz.off += thiz.r
-		thiz.w -= thiz.r
-		thiz.r = 0
+	if thiz.limited {
+		err := thiz.checkValueLimit()
+		if err != nil {
+			return err
+		}
+	}
+	if thiz.capture != nil {
+		err := thiz.flushCapture()
+		if err != nil {
+			return err
+		}
+	}
+	if thiz.zeroCopy {
+		return thiz.readTail()
+	}
+	if thiz.sniff {
+		return thiz.readEncoding()
+	}
+	keep := thiz.keep()
+	if keep > 0 {
+		if thiz.trackPositions {
+			thiz.countLines(keep)
+			thiz.lineR = 0
+		}
+		copy(thiz.rb, thiz.rb[keep:thiz.w])
+		thiz.shift(keep)
+		thiz.w -= keep
 	}
-	n, err := thiz.rd.Read(thiz.rb[thiz.w : cap(thiz.rb)-simdWidth])
+	if thiz.w == len(thiz.rb)-simdWidth {
+		// the retained start element fills the whole buffer
+		thiz.buf = make([]byte, 2*len(thiz.rb)-simdWidth)
+		copy(thiz.buf, thiz.rb[:thiz.w])
+		thiz.rb = thiz.buf
+	}
+	n, err := thiz.rd.Read(thiz.rb[thiz.w : len(thiz.rb)-simdWidth])
 	thiz.w += n
+	if thiz.limited && thiz.limits.MaxInputSize > 0 && thiz.off+thiz.w > thiz.limits.MaxInputSize {
+		return thiz.limitError(ErrInputTooLarge, thiz.limits.MaxInputSize)
+	}
 	if n <= 0 && err != nil {
 		return err
 	}
 	return nil
 }
 
+// keep returns the index of the first byte in the read buffer that must be
+// retained, which is the next unread byte or the start of the most recently
+// decoded start element, if it is still needed for WriteOuterXML.
+func (thiz *decoder) keep() int {
+	if thiz.mark >= 0 {
+		return thiz.mark
+	}
+	return thiz.r
+}
+
+// shift adjusts all indexes into the read buffer after
+// the first n bytes have been dropped.
+func (thiz *decoder) shift(n int) {
+	thiz.off += n
+	thiz.r -= n
+	if thiz.mark >= 0 {
+		thiz.mark -= n
+	}
+	thiz.captureR -= n
+}
+
+// readTail is the read0 of a Decoder reading from a byte slice.
+// Unless the input has a spare capacity of at least simdWidth bytes, it is
+// used as the read buffer except for its last simdWidth bytes, which must
+// not be covered by vector loads. Those are copied
+// (together with all other bytes still needed) into the padded buffer once
+// the rest of the input has been consumed.
+// Neither the input nor the copy are ever moved afterwards, so that
+// slices of them stay valid.
+func (thiz *decoder) readTail() error {
+	if thiz.tail {
+		return io.EOF
+	}
+	keep := thiz.keep()
+	if thiz.trackPositions {
+		thiz.countLines(keep)
+		thiz.lineR = 0
+	}
+	rest := thiz.input[keep:]
+	if len(rest)+simdWidth > len(thiz.buf) {
+		thiz.buf = make([]byte, len(rest)+simdWidth)
+	}
+	n := copy(thiz.buf, rest)
+	thiz.shift(keep)
+	thiz.rb = thiz.buf
+	thiz.w = n
+	thiz.tail = true
+	if thiz.r == n {
+		return io.EOF
+	}
+	return nil
+}
+
+// flushCapture writes the bytes consumed since the last call
+// to the writer of WriteOuterXML, if any.
+func (thiz *decoder) flushCapture() error {
+	if thiz.capture == nil {
+		return nil
+	}
+	_, err := thiz.capture.Write(thiz.rb[thiz.captureR:thiz.r])
+	thiz.captureR = thiz.r
+	return err
+}
+
+// countLines counts the newlines in the read buffer up to the given index
+// in order to compute line and column numbers.
+func (thiz *decoder) countLines(to int) {
+	if to <= thiz.lineR {
+		return
+	}
+	buf := thiz.rb[thiz.lineR:to]
+	n := countNewlines(buf)
+	if n > 0 {
+		thiz.line += n
+		thiz.lineStart = thiz.off + thiz.lineR + bytes.LastIndexByte(buf, '\n') + 1
+	}
+	thiz.lineR = to
+}
+
+func countNewlinesGeneric(buf []byte) int {
+	return bytes.Count(buf, bsnewline)
+}
+
+// markTokenStart records the position of the start of the next Token.
+func (thiz *decoder) markTokenStart() {
+	thiz.countLines(thiz.tokStart - thiz.off)
+	thiz.pos = Position{
+		Offset: thiz.tokStart,
+		Line:   thiz.line + 1,
+		Column: thiz.tokStart - thiz.lineStart + 1,
+	}
+}
+
+func (thiz *decoder) Position() Position {
+	return thiz.pos
+}
+
+func (thiz *decoder) TokenOffsets() (start, end int) {
+	if thiz.tokEnd < 0 {
+		thiz.tokEnd = thiz.tokenEnd()
+	}
+	return thiz.tokStart, thiz.tokEnd
+}
+
+// tokenEnd computes the end offset of the most recently decoded Token,
+// which is only possible until more input has been consumed.
+func (thiz *decoder) tokenEnd() int {
+	if !thiz.lastStartElement {
+		return thiz.off + thiz.r
+	}
+	// the closing ">" or "/>" of the start element is not consumed yet
+	if thiz.rb[thiz.r] == '/' {
+		return thiz.off + thiz.r + 2
+	}
+	return thiz.off + thiz.r + 1
+}
+
 func (thiz *decoder) unreadByte() {
 	thiz.r--
 }
@@ -95,6 +401,17 @@ func (thiz *decoder) discardBuffer() {
 	thiz.r = thiz.w
 }
 
+// ensure makes sure that at least n unread bytes are available in the read buffer.
+func (thiz *decoder) ensure(n int) error {
+	for thiz.r+n > thiz.w {
+		err := thiz.read0()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (thiz *decoder) discard(n int) (int, error) {
 	for thiz.r+n > thiz.w {
 		err := thiz.read0()
@@ -106,21 +423,75 @@ func (thiz *decoder) discard(n int) (int, error) {
 	return n, nil
 }
 
+// tokenBytes returns the token bytes consisting of the bytes appended to bb
+// from index i on followed by rb[j:k]. When reading from a byte slice and
+// nothing has been appended, the bytes are returned as a subslice of rb.
+func (thiz *decoder) tokenBytes(i, j, k int) []byte {
+	if thiz.zeroCopy && i == len(thiz.bb) {
+		return thiz.rb[j:k:k]
+	}
+	thiz.bb = append(thiz.bb, thiz.rb[j:k]...)
+	return thiz.bb[i:len(thiz.bb)]
+}
+
 func (thiz *decoder) InputOffset() int {
 	return thiz.off + thiz.r
 }
 
 func (thiz *decoder) Reset(r io.Reader) {
 	thiz.rd = r
+	thiz.rb = thiz.buf
+	thiz.input = nil
+	thiz.zeroCopy = false
+	thiz.tail = false
+	thiz.sniff = true
+	thiz.resetState()
+}
+
+func (thiz *decoder) ResetBytes(in []byte) {
+	in, bom := thiz.transcode(in)
+	thiz.rd = nil
+	thiz.rb = in
+	thiz.input = in
+	thiz.zeroCopy = true
+	thiz.tail = false
+	thiz.sniff = false
+	thiz.resetState()
+	thiz.w = max(len(in)-simdWidth, bom)
+	if cap(in)-len(in) >= simdWidth {
+		// vector loads may cover the spare capacity of
+		// the input, so that no tail needs to be copied
+		thiz.w = len(in)
+		thiz.tail = true
+	}
+	thiz.r = bom
+	thiz.docStart = bom
+}
+
+func (thiz *decoder) resetState() {
 	thiz.r = 0
 	thiz.w = 0
 	thiz.off = 0
+	thiz.mark = -1
+	thiz.capture = nil
+	thiz.tokens = 0
+	thiz.nsBindings = thiz.nsBindings[:0]
+	thiz.prefixes.active = false
 	thiz.attrs = thiz.attrs[:0]
 	thiz.bb = thiz.bb[:0]
 	thiz.top = 0
-	thiz.lastOpen = Name{}
-	thiz.preserveWhitespaces = [256]bool{}
+	thiz.line = 0
+	thiz.lineStart = 0
+	thiz.lineR = 0
+	thiz.pos = Position{}
+	thiz.tokStart = 0
+	thiz.tokEnd = 0
+	thiz.preserveWhitespaces[0] = false
 	thiz.lastStartElement = false
+	thiz.root = false
+	thiz.docStart = 0
+	thiz.decl = Declaration{}
+	thiz.hasDecl = false
 }
 
 func (thiz *decoder) skipWhitespacesGeneric(b byte) (byte, error) {
@@ -137,12 +508,54 @@ func (thiz *decoder) skipWhitespacesGeneric(b byte) (byte, error) {
 }
 
 func (thiz *decoder) NextToken(t *Token) error {
+	// the end of the token is computed on demand by TokenOffsets
+	thiz.tokEnd = -1
+	err := thiz.decodeNextToken(t)
+	if thiz.checks {
+		return thiz.checkToken(t, err)
+	}
+	return err
+}
+
+// checkToken applies the checks enabled by WithStrict, WithLimits and
+// WithCharacterChecks to the Token t decoded with the error err.
+func (thiz *decoder) checkToken(t *Token, err error) error {
+	thiz.valueLimit = 0
+	if err != nil {
+		if err == io.EOF && thiz.strict {
+			return thiz.checkEOF()
+		}
+		return err
+	}
+	if thiz.limited {
+		err = thiz.checkTokenLimits(t)
+		if err != nil {
+			return err
+		}
+	}
+	if thiz.checkCharacters {
+		return thiz.checkTokenCharacters(t)
+	}
+	return nil
+}
+
+func (thiz *decoder) decodeNextToken(t *Token) error {
+	thiz.mark = -1
 	for {
 		// read next character
 		b, err := thiz.readByte()
 		if err != nil {
+			thiz.betweenTokens = true
 			return err
 		}
+		thiz.tokStart = thiz.off + thiz.r - 1
+		if thiz.checks {
+			thiz.betweenTokens = false
+			thiz.valueLimit = 0
+			if thiz.trackPositions {
+				thiz.markTokenStart()
+			}
+		}
 		switch b {
 		case '>':
 			// Previous StartElement now got properly ended.
@@ -150,23 +563,6 @@ func (thiz *decoder) NextToken(t *Token) error {
 			// because there could have been an implicit
 			// "/>" close at the end of the start element.
 			thiz.lastStartElement = false
-		case '/':
-			if thiz.lastStartElement {
-				// Immediately closing last openend StartElement.
-				// This will generate an EndElement with the same
-				// name that we used in the previous StartElement.
-				_, err = thiz.discard(1)
-				if err != nil {
-					return err
-				}
-				thiz.lastStartElement = false
-				return thiz.decodeEndElement(t, thiz.lastOpen)
-			}
-			thiz.unreadByte()
-			cntn, err := thiz.decodeText(t)
-			if err != nil || !cntn {
-				return err
-			}
 		case '<':
 			b, err = thiz.readByte()
 			if err != nil {
@@ -180,41 +576,92 @@ func (thiz *decoder) NextToken(t *Token) error {
 					return err
 				}
 				thiz.unreadByte()
+				// the closing '>' is not consumed yet
+				thiz.tokEnd = thiz.off + thiz.r + 1
 				return nil
 			case '!':
-				// CDATA or comment
+				// CDATA, comment or DOCTYPE
 				b, err = thiz.readByte()
 				if err != nil {
 					return err
 				}
 				switch b {
 				case '-':
+					if thiz.comments {
+						thiz.lastStartElement = false
+						return thiz.decodeComment(t)
+					}
 					err = thiz.ignoreComment()
 					if err != nil {
 						return err
 					}
 				case '[':
 					thiz.lastStartElement = false
-					return thiz.readCDATA()
+					if thiz.strict && thiz.top == 0 {
+						return thiz.syntaxError(ErrMisplacedContent, "CDATA section outside of the root element")
+					}
+					return thiz.decodeCDATA(t)
+				case 'D':
+					thiz.lastStartElement = false
+					if thiz.strict && thiz.root {
+						return thiz.syntaxError(ErrMisplacedContent, "DOCTYPE declaration after the root element")
+					}
+					return thiz.decodeDirective(t)
 				default:
-					return errors.New("invalid XML: comment or CDATA expected")
+					return thiz.syntaxError(ErrInvalidMarkup, "invalid XML: comment, CDATA or DOCTYPE expected")
 				}
 			case '/':
-				var name Name
-				name, _, err = thiz.readName()
+				b, err = thiz.readName(&t.Name)
+				if err != nil {
+					return err
+				}
+				t.Space, b, err = thiz.readSpace(b)
 				if err != nil {
 					return err
 				}
+				if b != '>' {
+					return thiz.syntaxError(ErrInvalidMarkup, fmt.Sprintf("expected '>' following end element %s", t.Name))
+				}
 				thiz.lastStartElement = false
-				return thiz.decodeEndElement(t, name)
+				t.SelfClosing = false
+				return thiz.decodeEndElement(t)
 			default:
+				// retain the start element (without its '<', which may
+				// already be gone) in the read buffer for WriteOuterXML
+				thiz.mark = thiz.r - 1
 				thiz.lastStartElement = true
 				return thiz.decodeStartElement(t)
 			}
+		case '/':
+			if thiz.lastStartElement {
+				// Immediately closing last openend StartElement.
+				// This will generate an EndElement with the same
+				// name that we used in the previous StartElement.
+				_, err = thiz.discard(1)
+				if err != nil {
+					return err
+				}
+				thiz.tokStart = thiz.off + thiz.r
+				if thiz.trackPositions {
+					thiz.markTokenStart()
+				}
+				thiz.lastStartElement = false
+				t.Space = nil
+				t.SelfClosing = true
+				t.Name = thiz.names[thiz.top]
+				return thiz.decodeEndElement(t)
+			}
+			// a text starting with '/'
+			fallthrough
 		default:
 			thiz.lastStartElement = false
 			thiz.unreadByte()
-			cntn, err := thiz.decodeText(t)
+			var cntn bool
+			if thiz.plainText && thiz.tokStart != thiz.docStart {
+				cntn, err = thiz.decodeText(t)
+			} else {
+				cntn, err = thiz.decodeTextToken(t)
+			}
 			if err != nil || !cntn {
 				return err
 			}
@@ -223,15 +670,28 @@ func (thiz *decoder) NextToken(t *Token) error {
 }
 
 func (thiz *decoder) decodeProcInst(t *Token) error {
-	name, b, err := thiz.readName()
+	var name Name
+	b, err := thiz.readName(&name)
 	if err != nil {
 		return err
 	}
-	b, err = thiz.skipWhitespaces(b)
+	if thiz.strict {
+		err = thiz.checkProcInstTarget(name)
+		if err != nil {
+			return err
+		}
+	}
+	i := len(thiz.bb)
+	_, b, err = thiz.readSpace(b)
 	if err != nil {
 		return err
 	}
-	i := len(thiz.bb)
+	if !thiz.lossless {
+		i = len(thiz.bb)
+	}
+	if thiz.limited {
+		thiz.beginValue(thiz.limits.MaxTextLength, ErrTextTooLong)
+	}
 	j := i
 	for {
 		if b == '?' {
@@ -242,9 +702,22 @@ func (thiz *decoder) decodeProcInst(t *Token) error {
 					return err
 				}
 				if b2 == '>' {
+					if thiz.lossless {
+						j = len(thiz.bb)
+					}
+					if thiz.checkCharacters {
+						// the trailing whitespace is not part of the token
+						err = thiz.checkChars(thiz.bb[j:len(thiz.bb)])
+						if err != nil {
+							return err
+						}
+					}
 					t.Kind = TokenTypeProcInst
 					t.Name = name
 					t.ByteData = thiz.bb[i:j]
+					if name.Prefix == nil && bytes.Equal(name.Local, bsxml) {
+						return thiz.decodeDeclaration(t)
+					}
 					return nil
 				} else if b2 != '?' {
 					thiz.bb = append(thiz.bb, b, b2)
@@ -314,47 +787,341 @@ func (thiz *decoder) ignoreComment() error {
 	}
 }
 
-func (thiz *decoder) decodeEndElement(t *Token, name Name) error {
+// decodeEndElement completes the end element t, whose name has been read.
+func (thiz *decoder) decodeEndElement(t *Token) error {
 	if thiz.top == 0 {
-		return errors.New("unexpected end element without matching start element")
+		return thiz.syntaxError(ErrUnexpectedEndElement, "unexpected end element without matching start element")
 	}
+	if thiz.strict {
+		err := thiz.checkEndElement(t.Name)
+		if err != nil {
+			return err
+		}
+	}
+	if thiz.namespaces {
+		t.Name.Namespace = thiz.lookupNamespace(t.Name.Prefix)
+	}
+	t.Kind = TokenTypeEndElement
+	thiz.popFrame()
+	return nil
+}
+
+// popFrame releases the names and attributes of the innermost open element.
+func (thiz *decoder) popFrame() {
 	end := len(thiz.attrs) - int(thiz.numAttributes[thiz.top])
 	thiz.attrs = thiz.attrs[0:end]
 	thiz.bb = thiz.bb[:thiz.bbOffset[thiz.top]]
-	t.Kind = TokenTypeEndElement
-	t.Name = name
+	if thiz.namespaces {
+		thiz.unbindNamespaces()
+	}
 	thiz.top--
-	return nil
+}
+
+func (thiz *decoder) WriteOuterXML(w io.Writer) error {
+	if !thiz.lastStartElement || thiz.mark < 0 {
+		return ErrNotAtStartElement
+	}
+	_, err := w.Write(bsOpenAngleBracket)
+	if err != nil {
+		return err
+	}
+	thiz.capture = w
+	thiz.captureR = thiz.mark
+	err = thiz.Skip()
+	if err == nil {
+		err = thiz.flushCapture()
+	}
+	thiz.capture = nil
+	return err
+}
+
+func (thiz *decoder) Skip() error {
+	if thiz.tokEnd < 0 {
+		thiz.tokEnd = thiz.tokenEnd()
+	}
+	thiz.mark = -1
+	if thiz.top == 0 {
+		return thiz.syntaxError(ErrUnexpectedEndElement, "no open element to skip")
+	}
+	if thiz.lastStartElement {
+		// the closing ">" or "/>" of the start element is not consumed yet
+		thiz.lastStartElement = false
+		b, err := thiz.readByte()
+		if err != nil {
+			return err
+		}
+		if b == '/' {
+			_, err = thiz.discard(1)
+			if err != nil {
+				return err
+			}
+			thiz.popFrame()
+			return nil
+		}
+	}
+	depth := 1
+	for {
+		err := thiz.skipPastOpenAngleBracket()
+		if err != nil {
+			return err
+		}
+		b, err := thiz.readByte()
+		if err != nil {
+			return err
+		}
+		switch b {
+		case '/':
+			err = thiz.skipPast('>')
+			if err != nil {
+				return err
+			}
+			depth--
+			if depth == 0 {
+				thiz.popFrame()
+				return nil
+			}
+		case '?':
+			err = thiz.skipUntil(questAngleClose, indexQuest)
+		case '!':
+			b, err = thiz.readByte()
+			if err != nil {
+				return err
+			}
+			switch b {
+			case '-':
+				err = thiz.skipUntil(commentClose, indexDash)
+			case '[':
+				err = thiz.skipUntil(cdataClose, indexCloseBracket)
+			default:
+				return thiz.syntaxError(ErrInvalidMarkup, "invalid XML: comment or CDATA expected")
+			}
+		default:
+			var selfClosing bool
+			selfClosing, err = thiz.skipTag()
+			if !selfClosing {
+				depth++
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// skipPastOpenAngleBracket consumes all bytes up to and including the next '<'.
+func (thiz *decoder) skipPastOpenAngleBracket() error {
+	for {
+		k := indexOpenAngleBracket(thiz.rb[thiz.r:thiz.w])
+		if k >= 0 {
+			thiz.r += k + 1
+			return nil
+		}
+		thiz.discardBuffer()
+		err := thiz.read0()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// skipPast consumes all bytes up to and including the next occurrence of c.
+func (thiz *decoder) skipPast(c byte) error {
+	for {
+		k := bytes.IndexByte(thiz.rb[thiz.r:thiz.w], c)
+		if k >= 0 {
+			thiz.r += k + 1
+			return nil
+		}
+		thiz.discardBuffer()
+		err := thiz.read0()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// skipUntil consumes all bytes up to and including the given terminator,
+// like readUntil but without keeping them.
+func (thiz *decoder) skipUntil(term []byte, index func([]byte) int) error {
+	for {
+		for thiz.w > thiz.r {
+			k := index(thiz.rb[thiz.r:thiz.w])
+			if k < 0 {
+				thiz.discardBuffer()
+				break
+			}
+			thiz.r += k
+			err := thiz.ensure(len(term))
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(thiz.rb[thiz.r:thiz.r+len(term)], term) {
+				thiz.r += len(term)
+				return nil
+			}
+			thiz.r++
+		}
+		err := thiz.read0()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// skipTag consumes the rest of a start element up to and including its
+// closing '>', ignoring any '>' in attribute values, and reports whether
+// the element was self-closing.
+func (thiz *decoder) skipTag() (bool, error) {
+	var last byte
+	for {
+		b, err := thiz.readByte()
+		if err != nil {
+			return false, err
+		}
+		switch b {
+		case '"', '\'':
+			err = thiz.skipPast(b)
+			if err != nil {
+				return false, err
+			}
+		case '>':
+			return last == '/', nil
+		}
+		last = b
+	}
 }
 
 func (thiz *decoder) decodeStartElement(t *Token) error {
-	if thiz.top == 255 {
-		return errors.New("element nesting depth exceeds 255")
+	if thiz.top == thiz.maxDepth {
+		return thiz.syntaxError(ErrNestingTooDeep, fmt.Sprintf("element nesting depth exceeds %d", thiz.maxDepth))
+	}
+	if thiz.strict && thiz.top == 0 {
+		err := thiz.checkRootElement()
+		if err != nil {
+			return err
+		}
 	}
 	thiz.top++
+	if thiz.top == len(thiz.bbOffset) {
+		thiz.names = append(thiz.names, Name{})
+		thiz.nsOffs = append(thiz.nsOffs, 0)
+		thiz.bbOffset = append(thiz.bbOffset, 0)
+		thiz.numAttributes = append(thiz.numAttributes, 0)
+		thiz.preserveWhitespaces = append(thiz.preserveWhitespaces, false)
+	}
 	thiz.numAttributes[thiz.top] = 0
 	thiz.bbOffset[thiz.top] = int32(len(thiz.bb))
+	if thiz.namespaces {
+		thiz.nsOffs[thiz.top] = int32(len(thiz.nsBindings))
+	}
 	// inherit xml:space handling from the parent element (may be
 	// overridden by an xml:space attribute in decodeAttribute)
 	thiz.preserveWhitespaces[thiz.top] = thiz.preserveWhitespaces[thiz.top-1]
+	// the name is read in place (rather than copied there), so that
+	// the path of a SyntaxError within the attributes includes it
+	name := &thiz.names[thiz.top]
+	name.Local = nil
 	thiz.unreadByte()
-	name, b, err := thiz.readName()
+	b, err := thiz.readName(name)
 	if err != nil {
 		return err
 	}
 	var attributes []Attr
-	attributes, err = thiz.decodeAttributes(b)
+	attributes, b, err = thiz.decodeAttributes(t, b)
 	if err != nil {
 		return err
 	}
-	thiz.lastOpen = name
+	if thiz.strict {
+		err = thiz.checkDuplicateAttributes(attributes)
+		if err != nil {
+			return err
+		}
+	}
+	if thiz.checkNamespaces {
+		t.Name = *name
+		t.Attr = attributes
+		msg, category := thiz.nsChecker.checkNamespaces(t, thiz)
+		if category != nil {
+			return thiz.syntaxError(category, msg)
+		}
+	}
+	if thiz.namespaces {
+		thiz.bindNamespaces(name, attributes)
+	}
 	t.Kind = TokenTypeStartElement
-	t.Name = name
+	t.Name = *name
 	t.Attr = attributes
+	t.SelfClosing = b == '/'
 	thiz.unreadByte()
 	return nil
 }
 
+// decodeTextToken decodes a text with checks, entity decoding, in lossless
+// mode or if it may precede the XML declaration.
+func (thiz *decoder) decodeTextToken(t *Token) (bool, error) {
+	if thiz.limited {
+		thiz.beginValue(thiz.limits.MaxTextLength, ErrTextTooLong)
+	}
+	i := len(thiz.bb)
+	cntn, err := thiz.decodeText(t)
+	if thiz.checkCharacters {
+		cntn, err = thiz.checkWhitespaceText(t, i, cntn, err)
+	}
+	if thiz.tokStart == thiz.docStart && err == nil && !thiz.strict && (cntn || isWhitespaces(t.ByteData)) {
+		// tolerate whitespace preceding the XML declaration
+		thiz.docStart = thiz.off + thiz.r
+	}
+	if thiz.strict && thiz.top == 0 {
+		err = thiz.checkTopLevelText(t, i, cntn, err)
+	}
+	if err == io.EOF && thiz.lossless && len(thiz.bb) > i {
+		// keep text following the last element
+		t.Kind = TokenTypeTextElement
+		t.ByteData = thiz.bb[i:len(thiz.bb)]
+		return false, nil
+	}
+	if err != nil || cntn || !thiz.entities {
+		return cntn, err
+	}
+	if thiz.limited {
+		// limit the raw text, which is longer than the unescaped one
+		err = thiz.endValue(len(t.ByteData))
+		if err != nil {
+			return false, err
+		}
+	}
+	t.ByteData, err = thiz.unescapeTail(t.ByteData)
+	return false, err
+}
+
+// unescapeTail resolves the references in v, which must be the tail of bb,
+// and shrinks bb accordingly. When reading from a byte slice, v may also be
+// a subslice of the input, which is copied to bb if it contains references.
+func (thiz *decoder) unescapeTail(v []byte) ([]byte, error) {
+	if thiz.zeroCopy && !isTail(v, thiz.bb) {
+		if bytes.IndexByte(v, '&') < 0 {
+			return v, nil
+		}
+		i := len(thiz.bb)
+		thiz.bb = append(thiz.bb, v...)
+		v = thiz.bb[i:len(thiz.bb)]
+	}
+	u, err := unescape(v)
+	if err != nil {
+		return nil, thiz.syntaxError(ErrInvalidReference, err.Error())
+	}
+	thiz.bb = thiz.bb[:len(thiz.bb)-len(v)+len(u)]
+	return u, nil
+}
+
+// isTail reports whether v is the tail of bb.
+func isTail(v, bb []byte) bool {
+	if len(v) == 0 {
+		return true
+	}
+	return len(bb) >= len(v) && &bb[len(bb)-len(v)] == &v[0]
+}
+
 func (thiz *decoder) decodeTextGeneric(t *Token) (bool, error) {
 	i := len(thiz.bb)
 	onlyWhitespaces := true
@@ -367,12 +1134,11 @@ func (thiz *decoder) decodeTextGeneric(t *Token) (bool, error) {
 				if err != nil {
 					return false, err
 				}
-				if onlyWhitespaces && !thiz.preserveWhitespaces[thiz.top] {
+				if onlyWhitespaces && !thiz.preserveWhitespaces[thiz.top] && !thiz.lossless && !thiz.checkCharacters {
 					return true, nil
 				}
-				thiz.bb = append(thiz.bb, thiz.rb[j:k]...)
 				t.Kind = TokenTypeTextElement
-				t.ByteData = thiz.bb[i:len(thiz.bb)]
+				t.ByteData = thiz.tokenBytes(i, j, k)
 				return false, nil
 			}
 			onlyWhitespaces = onlyWhitespaces && isWhitespace(b)
@@ -386,34 +1152,231 @@ func (thiz *decoder) decodeTextGeneric(t *Token) (bool, error) {
 	}
 }
 
-func (thiz *decoder) readCDATA() error {
-	// discard "CDATA["
-	_, err := thiz.discard(6)
+// decodeCDATA decodes a CDATA section into a TokenTypeCharData token.
+// The leading "<![" must already have been consumed.
+func (thiz *decoder) decodeCDATA(t *Token) error {
+	for k := 0; k < len(bsCDATA); k++ {
+		b, err := thiz.readByte()
+		if err != nil {
+			return err
+		}
+		if b != bsCDATA[k] {
+			return thiz.syntaxError(ErrInvalidMarkup, "invalid XML: expected CDATA section")
+		}
+	}
+	data, err := thiz.readUntil(cdataClose, indexCloseBracket)
 	if err != nil {
 		return err
 	}
-	return errors.New("NYI")
+	t.Kind = TokenTypeCharData
+	t.ByteData = data
+	return nil
 }
 
-func (thiz *decoder) readName() (Name, byte, error) {
+// decodeComment decodes a comment into a TokenTypeComment token.
+// The leading "<!-" must already have been consumed.
+func (thiz *decoder) decodeComment(t *Token) error {
+	b, err := thiz.readByte()
+	if err != nil {
+		return err
+	}
+	if b != '-' {
+		return thiz.syntaxError(ErrInvalidMarkup, "invalid XML: expected comment")
+	}
+	data, err := thiz.readUntil(commentClose, indexDash)
+	if err != nil {
+		return err
+	}
+	t.Kind = TokenTypeComment
+	t.ByteData = data
+	return nil
+}
+
+// readUntil appends all bytes up to the given terminator to bb and consumes
+// the terminator, which may be split across buffer refills.
+// The index function locates the first byte of the terminator in a buffer.
+func (thiz *decoder) readUntil(term []byte, index func([]byte) int) ([]byte, error) {
+	if thiz.limited {
+		thiz.beginValue(thiz.limits.MaxTextLength, ErrTextTooLong)
+	}
+	i := len(thiz.bb)
+	for {
+		for thiz.w > thiz.r {
+			j := thiz.r
+			k := index(thiz.rb[j:thiz.w])
+			if k < 0 {
+				thiz.bb = append(thiz.bb, thiz.rb[j:thiz.w]...)
+				thiz.discardBuffer()
+				break
+			}
+			thiz.r = j + k
+			if thiz.r+len(term) <= thiz.w && bytes.Equal(thiz.rb[thiz.r:thiz.r+len(term)], term) {
+				thiz.r += len(term)
+				return thiz.tokenBytes(i, j, j+k), nil
+			}
+			thiz.bb = append(thiz.bb, thiz.rb[j:j+k]...)
+			err := thiz.ensure(len(term))
+			if err != nil {
+				return nil, err
+			}
+			if bytes.Equal(thiz.rb[thiz.r:thiz.r+len(term)], term) {
+				thiz.r += len(term)
+				return thiz.bb[i:len(thiz.bb)], nil
+			}
+			thiz.bb = append(thiz.bb, thiz.rb[thiz.r])
+			thiz.r++
+		}
+		err := thiz.read0()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func indexDash(buf []byte) int {
+	return bytes.IndexByte(buf, '-')
+}
+
+func indexQuest(buf []byte) int {
+	return bytes.IndexByte(buf, '?')
+}
+
+// decodeDirective decodes a <!DOCTYPE> declaration into a TokenTypeDirective
+// token, whose data is everything between the "<!" and the closing '>',
+// including a possible internal subset in square brackets.
+// The leading "<!D" must already have been consumed.
+func (thiz *decoder) decodeDirective(t *Token) error {
+	if thiz.limited {
+		thiz.beginValue(thiz.limits.MaxTextLength, ErrTextTooLong)
+		// the 'D' has already been consumed
+		thiz.valueStart--
+	}
+	i := len(thiz.bb)
+	thiz.bb = append(thiz.bb, bsDOCTYPE[0])
+	for k := 1; k < len(bsDOCTYPE); k++ {
+		b, err := thiz.readByte()
+		if err != nil {
+			return err
+		}
+		if b != bsDOCTYPE[k] {
+			return thiz.syntaxError(ErrInvalidMarkup, "invalid XML: expected DOCTYPE declaration")
+		}
+		thiz.bb = append(thiz.bb, b)
+	}
+	var quote byte
+	depth := 0
+	for {
+		b, err := thiz.readByte()
+		if err != nil {
+			return err
+		}
+		switch {
+		case quote != 0:
+			if b == quote {
+				quote = 0
+			}
+		case b == '"' || b == '\'':
+			quote = b
+		case b == '[':
+			depth++
+		case b == ']' && depth > 0:
+			depth--
+		case b == '>' && depth == 0:
+			t.Kind = TokenTypeDirective
+			t.ByteData = thiz.bb[i:len(thiz.bb)]
+			return nil
+		case b == '<' && depth > 0:
+			// Comments and processing instructions in the internal subset
+			// may contain unbalanced quotes and brackets, so copy them verbatim.
+			thiz.bb = append(thiz.bb, b)
+			err = thiz.copyMarkupDeclComment()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		thiz.bb = append(thiz.bb, b)
+	}
+}
+
+// copyMarkupDeclComment copies a comment or processing instruction
+// following a '<' in the internal subset of a DOCTYPE into bb.
+// Other markup declarations are left untouched.
+func (thiz *decoder) copyMarkupDeclComment() error {
+	err := thiz.ensure(3)
+	if err != nil {
+		return err
+	}
+	var term []byte
+	n := 0
+	if thiz.rb[thiz.r] == '?' {
+		term = questAngleClose
+		n = 1
+	} else if thiz.rb[thiz.r] == '!' && thiz.rb[thiz.r+1] == '-' && thiz.rb[thiz.r+2] == '-' {
+		term = commentClose
+		n = 3
+	} else {
+		return nil
+	}
+	thiz.bb = append(thiz.bb, thiz.rb[thiz.r:thiz.r+n]...)
+	thiz.r += n
+	i := len(thiz.bb)
+	for {
+		b, err := thiz.readByte()
+		if err != nil {
+			return err
+		}
+		thiz.bb = append(thiz.bb, b)
+		if len(thiz.bb)-i >= len(term) && bytes.HasSuffix(thiz.bb, term) {
+			return nil
+		}
+	}
+}
+
+func indexOpenAngleBracketGeneric(buf []byte) int {
+	return bytes.IndexByte(buf, '<')
+}
+
+func indexCloseBracketGeneric(buf []byte) int {
+	return bytes.IndexByte(buf, ']')
+}
+
+// readName reads a name into the given Name, which is left unchanged
+// on errors, and returns the separator following it.
+func (thiz *decoder) readName(name *Name) (byte, error) {
+	limited := thiz.limited && thiz.limits.MaxNameLength > 0
+	if limited {
+		thiz.beginValue(thiz.limits.MaxNameLength, ErrNameTooLong)
+	}
 	localOrPrefix, b, err := thiz.readSimpleName()
 	if err != nil {
-		return Name{}, 0, err
+		return 0, err
 	}
+	var local []byte
 	if b == ':' {
-		var local []byte
 		local, b, err = thiz.readSimpleName()
 		if err != nil {
-			return Name{}, 0, err
+			return 0, err
 		}
-		return Name{
-			Local:  local,
-			Prefix: localOrPrefix,
-		}, b, nil
+	} else {
+		local, localOrPrefix = localOrPrefix, nil
 	}
-	return Name{
-		Local: localOrPrefix,
-	}, b, nil
+	if limited {
+		n := len(local)
+		if localOrPrefix != nil {
+			n += len(localOrPrefix) + 1
+		}
+		err = thiz.endValue(n)
+		if err != nil {
+			return 0, err
+		}
+	}
+	// assign the fields one by one, which is faster
+	// than copying a whole Name into the heap
+	name.Local = local
+	name.Prefix = localOrPrefix
+	name.Namespace = nil
+	return b, nil
 }
 
 var seps = generateTable()
@@ -442,12 +1405,12 @@ func (thiz *decoder) readSimpleNameGeneric() ([]byte, byte, error) {
 		j := thiz.r
 		for k := j; k < thiz.w; k++ {
 			if isSeparator(thiz.rb[k]) {
-				thiz.bb = append(thiz.bb, thiz.rb[j:k]...)
+				name := thiz.tokenBytes(i, j, k)
 				_, err := thiz.discard(k - j + 1)
 				if err != nil {
 					return nil, 0, err
 				}
-				return thiz.bb[i:len(thiz.bb)], thiz.rb[k], nil
+				return name, thiz.rb[k], nil
 			}
 		}
 		thiz.bb = append(thiz.bb, thiz.rb[j:thiz.w]...)
@@ -459,67 +1422,146 @@ func (thiz *decoder) readSimpleNameGeneric() ([]byte, byte, error) {
 	}
 }
 
-func (thiz *decoder) decodeAttributes(b byte) ([]Attr, error) {
+// decodeAttributes decodes all attributes of a start element and
+// returns them together with the closing '/' or '>' character.
+// In lossless mode, the whitespace before it is stored in t.Space.
+func (thiz *decoder) decodeAttributes(t *Token, b byte) ([]Attr, byte, error) {
 	i := len(thiz.attrs)
 	for {
 		var err error
-		b, err = thiz.skipWhitespaces(b)
+		var space []byte
+		space, b, err = thiz.readSpace(b)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		switch b {
 		case '/', '>':
-			return thiz.attrs[i:len(thiz.attrs)], nil
+			t.Space = space
+			return thiz.attrs[i:len(thiz.attrs)], b, nil
 		default:
+			if thiz.limited && thiz.limits.MaxAttributes > 0 && int(thiz.numAttributes[thiz.top]) == thiz.limits.MaxAttributes {
+				return nil, 0, thiz.limitError(ErrTooManyAttributes, thiz.limits.MaxAttributes)
+			}
 			i := len(thiz.attrs)
-			thiz.attrs = append(thiz.attrs, Attr{})
-			err = thiz.decodeAttribute(&thiz.attrs[i])
+			if i < cap(thiz.attrs) {
+				// decodeAttribute overwrites the whole Attr
+				thiz.attrs = thiz.attrs[:i+1]
+			} else {
+				thiz.attrs = append(thiz.attrs, Attr{})
+			}
+			err = thiz.decodeAttribute(&thiz.attrs[i], space)
 			if err != nil {
-				return nil, err
+				return nil, 0, err
 			}
 			b, err = thiz.readByte()
 			if err != nil {
-				return nil, err
+				return nil, 0, err
 			}
 			thiz.numAttributes[thiz.top]++
 		}
 	}
 }
 
-// decodeAttribute parses a single XML attribute.
+// readSpace skips whitespace starting with b and returns the next
+// non-whitespace character. In lossless mode, the whitespace is
+// kept in bb and returned.
+func (thiz *decoder) readSpace(b byte) ([]byte, byte, error) {
+	if !isWhitespace(b) {
+		return nil, b, nil
+	}
+	return thiz.readSpaceSlow(b)
+}
+
+// readSpaceSlow is readSpace for a whitespace character b. In lossless
+// mode or with character checks, which only accept the whitespace of the
+// S production, the whitespace is read byte by byte.
+func (thiz *decoder) readSpaceSlow(b byte) ([]byte, byte, error) {
+	if !thiz.lossless && !thiz.checkCharacters {
+		b, err := thiz.skipWhitespaces(b)
+		return nil, b, err
+	}
+	i := len(thiz.bb)
+	for isWhitespace(b) {
+		if thiz.checkCharacters && !isSpace(b) {
+			return nil, 0, thiz.syntaxError(ErrInvalidCharacter, fmt.Sprintf("invalid character %U", rune(b)))
+		}
+		if thiz.lossless {
+			thiz.bb = append(thiz.bb, b)
+		}
+		var err error
+		b, err = thiz.readByte()
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	if i == len(thiz.bb) {
+		return nil, b, nil
+	}
+	return thiz.bb[i:len(thiz.bb)], b, nil
+}
+
+// decodeAttribute parses a single XML attribute preceded
+// by the given whitespace into attr.
 // After this function returns, the next reader symbol
 // is the byte after the closing single or double quote
 // of the attribute's value.
-func (thiz *decoder) decodeAttribute(attr *Attr) error {
+func (thiz *decoder) decodeAttribute(attr *Attr, space []byte) error {
 	thiz.unreadByte()
-	name, b, err := thiz.readName()
+	b, err := thiz.readName(&attr.Name)
 	if err != nil {
 		return err
 	}
-	b, err = thiz.skipWhitespaces(b)
+	name := &attr.Name
+	i := len(thiz.bb)
+	_, b, err = thiz.readSpace(b)
 	if err != nil {
 		return err
 	}
 	if b != '=' {
-		return fmt.Errorf("expected '=' character following attribute %+v", name)
+		return thiz.syntaxError(ErrInvalidAttribute, fmt.Sprintf("expected '=' character following attribute %s", name))
+	}
+	if thiz.lossless {
+		thiz.bb = append(thiz.bb, b)
 	}
 	b, err = thiz.readByte()
 	if err != nil {
 		return err
 	}
-	b, err = thiz.skipWhitespaces(b)
+	_, b, err = thiz.readSpace(b)
 	if err != nil {
 		return err
 	}
+	if b != '"' && b != '\'' {
+		return thiz.syntaxError(ErrInvalidAttribute, fmt.Sprintf("expected quoted value of attribute %s", name))
+	}
+	attr.Space = space
+	attr.Eq = nil
+	if thiz.lossless {
+		attr.Eq = thiz.bb[i:len(thiz.bb)]
+	}
+	if thiz.limited {
+		thiz.beginValue(thiz.limits.MaxAttributeValueLength, ErrAttributeValueTooLong)
+	}
 	value, singleQuote, err := thiz.readString(b)
 	if err != nil {
 		return err
 	}
+	if thiz.limited {
+		err = thiz.endValue(len(value))
+		if err != nil {
+			return err
+		}
+	}
+	if thiz.entities {
+		value, err = thiz.unescapeTail(value)
+		if err != nil {
+			return err
+		}
+	}
 	// xml:space?
 	if bytes.Equal(name.Prefix, bsxml) && bytes.Equal(name.Local, bsspace) {
 		thiz.preserveWhitespaces[thiz.top] = bytes.Equal(value, bspreserve)
 	}
-	attr.Name = name
 	attr.SingleQuote = singleQuote
 	attr.Value = value
 	return nil
@@ -533,12 +1575,12 @@ func (thiz *decoder) readString(b byte) ([]byte, bool, error) {
 		j := thiz.r
 		k := bytes.IndexByte(thiz.rb[j:thiz.w], b)
 		if k > -1 {
-			thiz.bb = append(thiz.bb, thiz.rb[j:j+k]...)
+			value := thiz.tokenBytes(i, j, j+k)
 			_, err := thiz.discard(k + 1)
 			if err != nil {
 				return nil, false, err
 			}
-			return thiz.bb[i:len(thiz.bb)], singleQuote, nil
+			return value, singleQuote, nil
 		}
 		thiz.bb = append(thiz.bb, thiz.rb[j:thiz.w]...)
 		thiz.discardBuffer()
@@ -4,6 +4,7 @@ import "github.com/klauspost/cpuid/v2"
 
 var canUseSSE = cpuid.CPU.Has(cpuid.SSE2) && cpuid.CPU.Has(cpuid.BMI1)
 var canUseAVX2 = canUseSSE && cpuid.CPU.Has(cpuid.AVX2)
+var canUsePOPCNT = canUseAVX2 && cpuid.CPU.Has(cpuid.POPCNT)
 
 func init() {
 	if canUseAVX2 {
@@ -103,12 +104,11 @@ func (thiz *decoder) decodeTextSSE(t *Token) (bool, error) {
 				if err != nil {
 					return false, err
 				}
-				if onlyWhitespaces && !thiz.preserveWhitespaces[thiz.top] {
+				if onlyWhitespaces && !thiz.preserveWhitespaces[thiz.top] && !thiz.lossless && !thiz.checkCharacters {
 					return true, nil
 				}
-				thiz.bb = append(thiz.bb, thiz.rb[j:j+c]...)
 				t.Kind = TokenTypeTextElement
-				t.ByteData = thiz.bb[i:len(thiz.bb)]
+				t.ByteData = thiz.tokenBytes(i, j, j+c)
 				return false, nil
 			}
 		}
@@ -136,12 +136,11 @@ func (thiz *decoder) decodeTextAVX2(t *Token) (bool, error) {
 				if err != nil {
 					return false, err
 				}
-				if onlyWhitespaces && !thiz.preserveWhitespaces[thiz.top] {
+				if onlyWhitespaces && !thiz.preserveWhitespaces[thiz.top] && !thiz.lossless && !thiz.checkCharacters {
 					return true, nil
 				}
-				thiz.bb = append(thiz.bb, thiz.rb[j:j+c]...)
 				t.Kind = TokenTypeTextElement
-				t.ByteData = thiz.bb[i:len(thiz.bb)]
+				t.ByteData = thiz.tokenBytes(i, j, j+c)
 				return false, nil
 			}
 		}
@@ -174,8 +173,7 @@ func (thiz *decoder) readSimpleNameAVX() ([]byte, byte, error) {
 				if err != nil {
 					return nil, 0, err
 				}
-				thiz.bb = append(thiz.bb, thiz.rb[j:j+c]...)
-				return thiz.bb[i:len(thiz.bb)], thiz.rb[j+c], nil
+				return thiz.tokenBytes(i, j, j+c), thiz.rb[j+c], nil
 			}
 		}
 		thiz.bb = append(thiz.bb, thiz.rb[j:thiz.w]...)
@@ -187,6 +185,84 @@ func (thiz *decoder) readSimpleNameAVX() ([]byte, byte, error) {
 	}
 }
 
+func indexOpenAngleBracket(buf []byte) int {
+	if canUseAVX2 {
+		return indexOpenAngleBracketAVX2(buf)
+	} else if canUseSSE {
+		return indexOpenAngleBracketSSE(buf)
+	}
+	return indexOpenAngleBracketGeneric(buf)
+}
+
+func indexOpenAngleBracketSSE(buf []byte) int {
+	c := 0
+	for len(buf) > c {
+		sidx, isWhole := clampToBuf(openAngleBracket16, 16, buf[c:])
+		c += sidx
+		if !isWhole {
+			return c
+		}
+	}
+	return -1
+}
+
+func indexOpenAngleBracketAVX2(buf []byte) int {
+	c := 0
+	for len(buf) > c {
+		sidx, isWhole := clampToBuf(openAngleBracket32, 32, buf[c:])
+		c += sidx
+		if !isWhole {
+			return c
+		}
+	}
+	return -1
+}
+
+func indexCloseBracket(buf []byte) int {
+	if canUseAVX2 {
+		return indexCloseBracketAVX2(buf)
+	} else if canUseSSE {
+		return indexCloseBracketSSE(buf)
+	}
+	return indexCloseBracketGeneric(buf)
+}
+
+func indexCloseBracketSSE(buf []byte) int {
+	c := 0
+	for len(buf) > c {
+		sidx, isWhole := clampToBuf(closeBracket16, 16, buf[c:])
+		c += sidx
+		if !isWhole {
+			return c
+		}
+	}
+	return -1
+}
+
+func indexCloseBracketAVX2(buf []byte) int {
+	c := 0
+	for len(buf) > c {
+		sidx, isWhole := clampToBuf(closeBracket32, 32, buf[c:])
+		c += sidx
+		if !isWhole {
+			return c
+		}
+	}
+	return -1
+}
+
+func countNewlines(buf []byte) int {
+	if canUsePOPCNT {
+		return countNewlinesAVX2(buf)
+	}
+	return countNewlinesGeneric(buf)
+}
+
+func countNewlinesAVX2(buf []byte) int {
+	whole := len(buf) &^ 31
+	return countNewlines32(buf[:whole]) + countNewlinesGeneric(buf[whole:])
+}
+
 // clampToBuf adapts a fixed-width SIMD scanner to arbitrary-length slices.
 // It clamps the returned index when buf is shorter than vectorSize and reports
 // whether the scan covered the entire provided buf (no early terminator found).
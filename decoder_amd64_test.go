@@ -21,9 +21,10 @@ func TestDecodeTextSSEStaleAngleBracket(t *testing.T) {
 	d := NewDecoder(strings.NewReader("z</a>")).(*decoder)
 	// Simulate a partially-filled read buffer whose stale region
 	// (beyond w) still contains a '<' from a previous fill.
-	copy(d.rb[:], "ab")
+	copy(d.rb, "ab")
 	d.rb[5] = '<'
 	d.r, d.w = 0, 2
+	d.sniff = false
 
 	var tk Token
 	cntn, err := d.decodeText(&tk)
@@ -31,3 +32,42 @@ func TestDecodeTextSSEStaleAngleBracket(t *testing.T) {
 	assert.False(t, cntn)
 	assert.Equal(t, "abz", string(tk.ByteData))
 }
+
+func TestIndexCloseBracket(t *testing.T) {
+	if !canUseSSE {
+		t.Skip("SSE2+BMI1 not available")
+	}
+	buf := make([]byte, 100+simdWidth)
+	copy(buf, strings.Repeat("a", 70)+"]")
+	assert.Equal(t, 70, indexCloseBracketSSE(buf[:80]))
+	assert.Equal(t, -1, indexCloseBracketSSE(buf[:70]))
+	if canUseAVX2 {
+		assert.Equal(t, 70, indexCloseBracketAVX2(buf[:80]))
+		assert.Equal(t, -1, indexCloseBracketAVX2(buf[:70]))
+	}
+}
+
+func TestIndexOpenAngleBracket(t *testing.T) {
+	if !canUseSSE {
+		t.Skip("SSE2+BMI1 not available")
+	}
+	buf := make([]byte, 100+simdWidth)
+	copy(buf, strings.Repeat("a", 70)+"<")
+	assert.Equal(t, 70, indexOpenAngleBracketSSE(buf[:80]))
+	assert.Equal(t, -1, indexOpenAngleBracketSSE(buf[:70]))
+	if canUseAVX2 {
+		assert.Equal(t, 70, indexOpenAngleBracketAVX2(buf[:80]))
+		assert.Equal(t, -1, indexOpenAngleBracketAVX2(buf[:70]))
+	}
+}
+
+func TestCountNewlines(t *testing.T) {
+	buf := []byte(strings.Repeat("ab\ncdefg\n\n", 20))
+	for i := 0; i <= len(buf); i++ {
+		expected := countNewlinesGeneric(buf[:i])
+		if canUsePOPCNT {
+			assert.Equal(t, expected, countNewlinesAVX2(buf[:i]))
+		}
+		assert.Equal(t, expected, countNewlines(buf[:i]))
+	}
+}
@@ -11,3 +11,15 @@ func (thiz *decoder) decodeText(t *Token) (bool, error) {
 func (thiz *decoder) readSimpleName() ([]byte, byte, error) {
 	return thiz.readSimpleNameGeneric()
 }
+
+func indexOpenAngleBracket(buf []byte) int {
+	return indexOpenAngleBracketGeneric(buf)
+}
+
+func indexCloseBracket(buf []byte) int {
+	return indexCloseBracketGeneric(buf)
+}
+
+func countNewlines(buf []byte) int {
+	return countNewlinesGeneric(buf)
+}
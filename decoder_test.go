@@ -2,6 +2,9 @@ package gosaxml_test
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
 	"github.com/HBTGmbH/gosaxml"
 	"github.com/stretchr/testify/assert"
 	"io"
@@ -28,6 +31,26 @@ func BenchmarkNextToken(b *testing.B) {
 	}
 }
 
+func BenchmarkNextTokenCDATA(b *testing.B) {
+	// given
+	doc := "<a><![CDATA[some <unparsed> character data]]></a>"
+	r := strings.NewReader(doc)
+	dec := gosaxml.NewDecoder(r)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		var tk gosaxml.Token
+		r.Reset(doc)
+		dec.Reset(r)
+		err1 := dec.NextToken(&tk)
+		assert.Nil(b, err1)
+		err2 := dec.NextToken(&tk)
+		assert.Nil(b, err2)
+	}
+}
+
 func TestDecodeStartEnd(t *testing.T) {
 	// given
 	doc := "<a></a>"
@@ -102,9 +125,10 @@ func TestDecodeStartEndImplicit(t *testing.T) {
 
 	// then
 	assert.Nil(t, err1)
-	assert.Equal(t, startElement("a"), t1)
+	assert.Equal(t, selfClosing(startElement("a")), t1)
 	assert.Nil(t, err2)
 	assertEndElement(t, "a", t2)
+	assert.True(t, t2.SelfClosing)
 	assert.Equal(t, io.EOF, err3)
 }
 
@@ -141,13 +165,13 @@ func TestDecodeNested2(t *testing.T) {
 	assert.Equal(t, startElementWithAttr("a", "attr1", "foo"), tk)
 	err = dec.NextToken(&tk)
 	assert.Nil(t, err)
-	assert.Equal(t, startElementWithAttr("b1", "attr21", "bar1"), tk)
+	assert.Equal(t, selfClosing(startElementWithAttr("b1", "attr21", "bar1")), tk)
 	err = dec.NextToken(&tk)
 	assert.Nil(t, err)
 	assertEndElement(t, "b1", tk)
 	err = dec.NextToken(&tk)
 	assert.Nil(t, err)
-	assert.Equal(t, startElementWithAttr("c11", "attr311", "baz11"), tk)
+	assert.Equal(t, selfClosing(startElementWithAttr("c11", "attr311", "baz11")), tk)
 	err = dec.NextToken(&tk)
 	assert.Nil(t, err)
 	assertEndElement(t, "c11", tk)
@@ -178,6 +202,199 @@ func TestIgnoreComments(t *testing.T) {
 	assert.Equal(t, io.EOF, err3)
 }
 
+func TestDecodeCDATA(t *testing.T) {
+	// given
+	doc := "<a><![CDATA[<b>]] & ]>]]]]></a>"
+	dec := gosaxml.NewDecoder(bufio.NewReaderSize(strings.NewReader(doc), 1024))
+	var tk gosaxml.Token
+
+	// when/then
+	err := dec.NextToken(&tk)
+	assert.Nil(t, err)
+	assert.Equal(t, startElement("a"), tk)
+	err = dec.NextToken(&tk)
+	assert.Nil(t, err)
+	assertCharData(t, "<b>]] & ]>]]", tk)
+	err = dec.NextToken(&tk)
+	assert.Nil(t, err)
+	assertEndElement(t, "a", tk)
+	err = dec.NextToken(&tk)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestDecodeCDATAInvalid(t *testing.T) {
+	// given
+	doc := "<a><![CDATX[x]]></a>"
+	dec := gosaxml.NewDecoder(strings.NewReader(doc))
+	var tk gosaxml.Token
+
+	// when
+	err1 := dec.NextToken(&tk)
+	err2 := dec.NextToken(&tk)
+
+	// then
+	assert.Nil(t, err1)
+	assertSyntaxError(t, err2, gosaxml.ErrInvalidMarkup, "invalid XML: expected CDATA section")
+}
+
+func TestDecodeDirective(t *testing.T) {
+	// given
+	doctype := `DOCTYPE a SYSTEM "a>.dtd" [
+  <!ENTITY e "]>">
+  <!-- it's ]> -->
+  <?pi ']>?>
+]`
+	doc := "<!" + doctype + "><a/>"
+	dec := gosaxml.NewDecoder(bufio.NewReaderSize(strings.NewReader(doc), 1024))
+	var tk gosaxml.Token
+
+	// when/then
+	err := dec.NextToken(&tk)
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(gosaxml.TokenTypeDirective), tk.Kind)
+	assert.Equal(t, doctype, string(tk.ByteData))
+	err = dec.NextToken(&tk)
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(gosaxml.TokenTypeStartElement), tk.Kind)
+	assert.Equal(t, []byte("a"), tk.Name.Local)
+}
+
+func TestDecodeDirectiveInvalid(t *testing.T) {
+	// given
+	dec := gosaxml.NewDecoder(strings.NewReader("<!DOCTYPO a><a/>"))
+	var tk gosaxml.Token
+
+	// when
+	err := dec.NextToken(&tk)
+
+	// then
+	assertSyntaxError(t, err, gosaxml.ErrInvalidMarkup, "invalid XML: expected DOCTYPE declaration")
+}
+
+func TestDecodeComments(t *testing.T) {
+	// given
+	doc := "<a><!-- Hello - World --><!----></a>"
+	dec := gosaxml.NewDecoder(strings.NewReader(doc), gosaxml.WithComments())
+	var tk gosaxml.Token
+
+	// when/then
+	err := dec.NextToken(&tk)
+	assert.Nil(t, err)
+	assert.Equal(t, startElement("a"), tk)
+	err = dec.NextToken(&tk)
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(gosaxml.TokenTypeComment), tk.Kind)
+	assert.Equal(t, " Hello - World ", string(tk.ByteData))
+	err = dec.NextToken(&tk)
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(gosaxml.TokenTypeComment), tk.Kind)
+	assert.Equal(t, "", string(tk.ByteData))
+	err = dec.NextToken(&tk)
+	assert.Nil(t, err)
+	assertEndElement(t, "a", tk)
+}
+
+func TestDecodeCommentsChunked(t *testing.T) {
+	// given
+	rd := &chunkReader{
+		[]byte(`<a><!`),
+		[]byte(`-- x -`),
+		[]byte(`- y --`),
+		[]byte(`></a>`),
+	}
+	dec := gosaxml.NewDecoder(rd, gosaxml.WithComments())
+	var tk gosaxml.Token
+
+	// when
+	err1 := dec.NextToken(&tk)
+	err2 := dec.NextToken(&tk)
+
+	// then
+	assert.Nil(t, err1)
+	assert.Nil(t, err2)
+	assert.Equal(t, uint8(gosaxml.TokenTypeComment), tk.Kind)
+	assert.Equal(t, " x -- y ", string(tk.ByteData))
+}
+
+func TestDecodeEntities(t *testing.T) {
+	// given
+	doc := `<a b="&quot;x&apos; &#60;&#x3E;">&lt;&amp;&gt; &#8364;&#x1F600;</a>`
+	dec := gosaxml.NewDecoder(strings.NewReader(doc), gosaxml.WithEntityDecoding())
+	var tk gosaxml.Token
+
+	// when/then
+	err := dec.NextToken(&tk)
+	assert.Nil(t, err)
+	assert.Equal(t, startElementWithAttr("a", "b", `"x' <>`), tk)
+	err = dec.NextToken(&tk)
+	assert.Nil(t, err)
+	assertTextElement(t, "<&> €😀", tk)
+	err = dec.NextToken(&tk)
+	assert.Nil(t, err)
+	assertEndElement(t, "a", tk)
+}
+
+func TestDecodeEntitiesDisabled(t *testing.T) {
+	tokens, err := decodeTexts("<a>&lt;&#x20AC;</a>")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"&lt;&#x20AC;"}, tokens)
+}
+
+func TestDecodeInvalidEntities(t *testing.T) {
+	for doc, msg := range map[string]string{
+		"<a>&lt</a>":           "invalid XML: unterminated entity reference",
+		"<a>&nbsp;</a>":        "invalid XML: undefined entity reference &nbsp;",
+		"<a>&#;</a>":           "invalid XML: empty character reference",
+		"<a>&#x;</a>":          "invalid XML: empty character reference",
+		"<a>&#12a;</a>":        "invalid XML: malformed character reference &#12a;",
+		"<a>&#0;</a>":          "invalid XML: character reference &#0; is not a legal character",
+		"<a>&#xD800;</a>":      "invalid XML: character reference &#xD800; is not a legal character",
+		"<a>&#x110000;</a>":    "invalid XML: character reference &#x110000; out of range",
+		"<a b=\"&unknown;\"/>": "invalid XML: undefined entity reference &unknown;",
+	} {
+		_, err := decodeTexts(doc, gosaxml.WithEntityDecoding())
+		assertSyntaxError(t, err, gosaxml.ErrInvalidReference, msg)
+	}
+}
+
+func BenchmarkNextTokenEntities(b *testing.B) {
+	// given
+	doc := "<a b=\"&quot;&#x20AC;&quot;\">Fish &amp; Chips</a>"
+	r := strings.NewReader(doc)
+	dec := gosaxml.NewDecoder(r, gosaxml.WithEntityDecoding())
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		var tk gosaxml.Token
+		r.Reset(doc)
+		dec.Reset(r)
+		err1 := dec.NextToken(&tk)
+		assert.Nil(b, err1)
+		err2 := dec.NextToken(&tk)
+		assert.Nil(b, err2)
+	}
+}
+
+func decodeTexts(doc string, opts ...gosaxml.DecoderOption) ([]string, error) {
+	dec := gosaxml.NewDecoder(strings.NewReader(doc), opts...)
+	var tk gosaxml.Token
+	var texts []string
+	for {
+		err := dec.NextToken(&tk)
+		if err == io.EOF {
+			return texts, nil
+		}
+		if err != nil {
+			return texts, err
+		}
+		if tk.Kind == gosaxml.TokenTypeTextElement {
+			texts = append(texts, string(tk.ByteData))
+		}
+	}
+}
+
 type chunkReader [][]byte
 
 func (r *chunkReader) Read(p []byte) (n int, err error) {
@@ -213,7 +430,7 @@ func TestDecodeChunked(t *testing.T) {
 	assert.Equal(t, startElementWithAttr("foo", "a", "2"), tk)
 	err = dec.NextToken(&tk)
 	assert.Nil(t, err)
-	assert.Equal(t, startElement("bar"), tk)
+	assert.Equal(t, selfClosing(startElement("bar")), tk)
 	err = dec.NextToken(&tk)
 	assert.Nil(t, err)
 	assertEndElement(t, "bar", tk)
@@ -227,6 +444,653 @@ func TestDecodeChunked(t *testing.T) {
 	assert.Equal(t, io.EOF, err)
 }
 
+func TestDecodeCDATAChunked(t *testing.T) {
+	// given
+	rd := &chunkReader{
+		[]byte(`<a><![CD`),
+		[]byte(`ATA[hello]`),
+		[]byte(`]world]`),
+		[]byte(`]`),
+		[]byte(`></a>`),
+	}
+	dec := gosaxml.NewDecoder(rd)
+	var tk gosaxml.Token
+
+	// when/then
+	err := dec.NextToken(&tk)
+	assert.Nil(t, err)
+	assert.Equal(t, startElement("a"), tk)
+	err = dec.NextToken(&tk)
+	assert.Nil(t, err)
+	assertCharData(t, "hello]]world", tk)
+	err = dec.NextToken(&tk)
+	assert.Nil(t, err)
+	assertEndElement(t, "a", tk)
+}
+
+func TestDecodeCDATALargerThanReadBuffer(t *testing.T) {
+	// given
+	text := strings.Repeat("0123456789]>", 500)
+	doc := "<a><![CDATA[" + text + "]]></a>"
+	dec := gosaxml.NewDecoder(strings.NewReader(doc))
+	var tk gosaxml.Token
+
+	// when
+	err1 := dec.NextToken(&tk)
+	err2 := dec.NextToken(&tk)
+
+	// then
+	assert.Nil(t, err1)
+	assert.Nil(t, err2)
+	assertCharData(t, text, tk)
+}
+
+func TestReadBufferSize(t *testing.T) {
+	// given
+	long := strings.Repeat("x", 200)
+	doc := `<?xml version="1.0"?><` + long + ` a="` + long + `"><!--` + long + `--><b>` + long +
+		`</b><![CDATA[` + long + `]]><c/></` + long + `>`
+	expected, err := decodeTokens(doc, gosaxml.WithComments())
+	assert.Nil(t, err)
+
+	for _, size := range []int{1, gosaxml.MinReadBufferSize, 100, 1 << 20} {
+		// when
+		actual, err := decodeTokens(doc, gosaxml.WithComments(), gosaxml.WithReadBufferSize(size),
+			gosaxml.WithInitialCapacities(0, 0))
+
+		// then
+		assert.Nil(t, err)
+		assert.Equal(t, expected, actual, "read buffer size %d", size)
+	}
+}
+
+func TestNegativeInitialCapacities(t *testing.T) {
+	// given
+	doc := `<a b="1" c="2">x<d/></a>`
+	expected, err := decodeTokens(doc)
+	assert.Nil(t, err)
+
+	// when
+	actual, err := decodeTokens(doc, gosaxml.WithInitialCapacities(-1, -1))
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, expected, actual)
+}
+
+func decodeTokens(doc string, opts ...gosaxml.DecoderOption) ([]string, error) {
+	return decodeAllTokens(gosaxml.NewDecoder(strings.NewReader(doc), opts...))
+}
+
+func decodeAllTokens(dec gosaxml.Decoder) ([]string, error) {
+	var tokens []string
+	for {
+		var tk gosaxml.Token
+		err := dec.NextToken(&tk)
+		if err == io.EOF {
+			return tokens, nil
+		}
+		if err != nil {
+			return tokens, err
+		}
+		var s strings.Builder
+		fmt.Fprintf(&s, "%d %s %s", tk.Kind, tk.Name, tk.ByteData)
+		for _, attr := range tk.Attr {
+			fmt.Fprintf(&s, " %s=%s", attr.Name, attr.Value)
+		}
+		tokens = append(tokens, s.String())
+	}
+}
+
+func BenchmarkNextTokenBytes(b *testing.B) {
+	// given
+	doc := []byte("<a attr1=\"1\" attr2=\"2\" xmlns=\"https://mydomain.org\">some text</a>")
+	dec := gosaxml.NewBytesDecoder(doc)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		var tk gosaxml.Token
+		dec.ResetBytes(doc)
+		err1 := dec.NextToken(&tk)
+		assert.Nil(b, err1)
+		err2 := dec.NextToken(&tk)
+		assert.Nil(b, err2)
+		err3 := dec.NextToken(&tk)
+		assert.Nil(b, err3)
+	}
+}
+
+func BenchmarkNextTokenReader(b *testing.B) {
+	// given
+	doc := []byte("<a attr1=\"1\" attr2=\"2\" xmlns=\"https://mydomain.org\">some text</a>")
+	r := bytes.NewReader(doc)
+	dec := gosaxml.NewDecoder(r)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		var tk gosaxml.Token
+		r.Reset(doc)
+		dec.Reset(r)
+		err1 := dec.NextToken(&tk)
+		assert.Nil(b, err1)
+		err2 := dec.NextToken(&tk)
+		assert.Nil(b, err2)
+		err3 := dec.NextToken(&tk)
+		assert.Nil(b, err3)
+	}
+}
+
+func BenchmarkDecodeBytes(b *testing.B) {
+	// given
+	doc := []byte(`<?xml version="1.0" encoding="UTF-8"?><catalog>` +
+		strings.Repeat("\n  <book id=\"bk101\">\n    <author>Some Author</author>\n    <title>Some Title</title>\n  </book>", 1000) +
+		"</catalog>")
+	dec := gosaxml.NewBytesDecoder(doc)
+	var tk gosaxml.Token
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(doc)))
+
+	for i := 0; i < b.N; i++ {
+		dec.ResetBytes(doc)
+		err := dec.NextToken(&tk)
+		for err == nil {
+			err = dec.NextToken(&tk)
+		}
+		assert.Equal(b, io.EOF, err)
+	}
+}
+
+func BenchmarkDecodeReader(b *testing.B) {
+	// given
+	doc := []byte(`<?xml version="1.0" encoding="UTF-8"?><catalog>` +
+		strings.Repeat("\n  <book id=\"bk101\">\n    <author>Some Author</author>\n    <title>Some Title</title>\n  </book>", 1000) +
+		"</catalog>")
+	r := bytes.NewReader(doc)
+	dec := gosaxml.NewDecoder(r)
+	var tk gosaxml.Token
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(doc)))
+
+	for i := 0; i < b.N; i++ {
+		r.Reset(doc)
+		dec.Reset(r)
+		err := dec.NextToken(&tk)
+		for err == nil {
+			err = dec.NextToken(&tk)
+		}
+		assert.Equal(b, io.EOF, err)
+	}
+}
+
+func TestBytesDecoder(t *testing.T) {
+	long := strings.Repeat("x", 3000)
+	for _, doc := range []string{
+		"<a/>",
+		"<a>b</a>",
+		`<?xml version="1.0"?><!DOCTYPE a><a xml:space="preserve"> <b x='1' y="&lt;2&gt;">t&amp;t</b> </a>`,
+		`<` + long + ` a="` + long + `"><!--` + long + `--><b>` + long + `</b><![CDATA[` + long + `]]></` + long + `>`,
+		strings.Repeat(`<a b="1"><!--c--><![CDATA[d]]>e&amp;f<?g h?></a>`, 100),
+	} {
+		for _, opts := range [][]gosaxml.DecoderOption{
+			nil,
+			{gosaxml.WithComments(), gosaxml.WithEntityDecoding()},
+		} {
+			for _, spare := range []int{0, 64} {
+				// given
+				input := append(make([]byte, 0, len(doc)+spare), doc...)
+				expected, err := decodeTokens(doc, opts...)
+				assert.Nil(t, err)
+
+				// when
+				actual, err := decodeAllTokens(gosaxml.NewBytesDecoder(input, opts...))
+
+				// then
+				assert.Nil(t, err)
+				assert.Equal(t, expected, actual)
+				assert.Equal(t, doc, string(input))
+			}
+		}
+	}
+}
+
+func TestBytesDecoderIsZeroCopy(t *testing.T) {
+	// given
+	input := []byte(`<a b="value">text</a><!-- more than thirty-two trailing bytes -->`)
+	dec := gosaxml.NewBytesDecoder(input)
+	var tk1, tk2 gosaxml.Token
+
+	// when
+	err1 := dec.NextToken(&tk1)
+	err2 := dec.NextToken(&tk2)
+
+	// then
+	assert.Nil(t, err1)
+	assert.Nil(t, err2)
+	assert.Same(t, &input[1], &tk1.Name.Local[0])
+	assert.Same(t, &input[6], &tk1.Attr[0].Value[0])
+	assert.Same(t, &input[13], &tk2.ByteData[0])
+}
+
+func TestBytesDecoderIsZeroCopyWithSpareCapacity(t *testing.T) {
+	// given
+	input := append(make([]byte, 0, 64), "<a>text</a>"...)
+	dec := gosaxml.NewBytesDecoder(input)
+	var tk1, tk2 gosaxml.Token
+
+	// when
+	err1 := dec.NextToken(&tk1)
+	err2 := dec.NextToken(&tk2)
+
+	// then
+	assert.Nil(t, err1)
+	assert.Nil(t, err2)
+	assert.Same(t, &input[1], &tk1.Name.Local[0])
+	assert.Same(t, &input[3], &tk2.ByteData[0])
+}
+
+func TestBytesDecoderResetToReader(t *testing.T) {
+	// given
+	dec := gosaxml.NewBytesDecoder([]byte("<a>b</a>"))
+	var tk gosaxml.Token
+	assert.Nil(t, dec.NextToken(&tk))
+
+	// when
+	dec.Reset(strings.NewReader("<c>d</c>"))
+	tokens, err := decodeAllTokens(dec)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1 c ", "5  d", "2 c "}, tokens)
+}
+
+func BenchmarkSkip(b *testing.B) {
+	// given
+	doc := "<r><a x=\"1\">" + strings.Repeat("<b y='2'>some text<c/></b>", 50) + "</a><d/></r>"
+	r := strings.NewReader(doc)
+	dec := gosaxml.NewDecoder(r)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		var tk gosaxml.Token
+		r.Reset(doc)
+		dec.Reset(r)
+		assert.Nil(b, dec.NextToken(&tk))
+		assert.Nil(b, dec.NextToken(&tk))
+		assert.Nil(b, dec.Skip())
+		assert.Nil(b, dec.NextToken(&tk))
+	}
+}
+
+func TestSkip(t *testing.T) {
+	doc := `<r><a x=">" y='/>'><b><!-- </a> --><?pi </a>?><![CDATA[</a>]]>t</b><c/><a></a></a><d/></r>`
+	rd := chunkReader{}
+	for i := 0; i < len(doc); i++ {
+		rd = append(rd, []byte{doc[i]})
+	}
+	for name, dec := range map[string]gosaxml.Decoder{
+		"reader":  gosaxml.NewDecoder(strings.NewReader(doc)),
+		"chunked": gosaxml.NewDecoder(&rd),
+		"bytes":   gosaxml.NewBytesDecoder([]byte(doc)),
+	} {
+		// given
+		var tk gosaxml.Token
+		assert.Nil(t, dec.NextToken(&tk), name)
+		assert.Nil(t, dec.NextToken(&tk), name)
+
+		// when
+		err := dec.Skip()
+
+		// then
+		assert.Nil(t, err, name)
+		tokens, err := decodeAllTokens(dec)
+		assert.Nil(t, err, name)
+		assert.Equal(t, []string{"1 d ", "2 d ", "2 r "}, tokens, name)
+	}
+}
+
+func TestSkipSelfClosing(t *testing.T) {
+	// given
+	dec := gosaxml.NewDecoder(strings.NewReader("<r><a/><b/></r>"))
+	var tk gosaxml.Token
+	assert.Nil(t, dec.NextToken(&tk))
+	assert.Nil(t, dec.NextToken(&tk))
+
+	// when
+	err := dec.Skip()
+
+	// then
+	assert.Nil(t, err)
+	tokens, err := decodeAllTokens(dec)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1 b ", "2 b ", "2 r "}, tokens)
+}
+
+func TestSkipRestOfElement(t *testing.T) {
+	// given
+	dec := gosaxml.NewDecoder(strings.NewReader("<r><a>text<b/>more</a><c/></r>"))
+	var tk gosaxml.Token
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, dec.NextToken(&tk))
+	}
+	assertTextElement(t, "text", tk)
+
+	// when
+	err := dec.Skip()
+
+	// then
+	assert.Nil(t, err)
+	tokens, err := decodeAllTokens(dec)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1 c ", "2 c ", "2 r "}, tokens)
+}
+
+func TestSkipWithoutOpenElement(t *testing.T) {
+	// given
+	dec := gosaxml.NewDecoder(strings.NewReader("<a/>"))
+
+	// when
+	err := dec.Skip()
+
+	// then
+	assert.ErrorIs(t, err, gosaxml.ErrUnexpectedEndElement)
+}
+
+func TestSkipUnexpectedEOF(t *testing.T) {
+	// given
+	dec := gosaxml.NewDecoder(strings.NewReader("<a><b>"))
+	var tk gosaxml.Token
+	assert.Nil(t, dec.NextToken(&tk))
+
+	// when
+	err := dec.Skip()
+
+	// then
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestWriteOuterXML(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	outer := `<a x=">" y='` + long + `'><b><!-- </a> -->` + long + `</b><c/><?pi?></a >`
+	doc := `<r><z/>` + outer + `<d/></r>`
+	for name, dec := range map[string]gosaxml.Decoder{
+		"reader":      gosaxml.NewDecoder(strings.NewReader(doc)),
+		"small":       gosaxml.NewDecoder(strings.NewReader(doc), gosaxml.WithReadBufferSize(gosaxml.MinReadBufferSize)),
+		"bytes":       gosaxml.NewBytesDecoder([]byte(doc)),
+		"bytes small": gosaxml.NewBytesDecoder([]byte(doc), gosaxml.WithReadBufferSize(gosaxml.MinReadBufferSize)),
+	} {
+		// given
+		var tk gosaxml.Token
+		for i := 0; i < 4; i++ {
+			assert.Nil(t, dec.NextToken(&tk), name)
+		}
+		var buf bytes.Buffer
+
+		// when
+		err := dec.WriteOuterXML(&buf)
+
+		// then
+		assert.Nil(t, err, name)
+		assert.Equal(t, outer, buf.String(), name)
+		tokens, err := decodeAllTokens(dec)
+		assert.Nil(t, err, name)
+		assert.Equal(t, []string{"1 d ", "2 d ", "2 r "}, tokens, name)
+	}
+}
+
+func TestWriteOuterXMLSelfClosing(t *testing.T) {
+	// given
+	dec := gosaxml.NewDecoder(strings.NewReader(`<r><a b="c" /><d/></r>`))
+	var tk gosaxml.Token
+	assert.Nil(t, dec.NextToken(&tk))
+	assert.Nil(t, dec.NextToken(&tk))
+	var buf bytes.Buffer
+
+	// when
+	err := dec.WriteOuterXML(&buf)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, `<a b="c" />`, buf.String())
+	assert.Nil(t, dec.NextToken(&tk))
+	assert.Equal(t, selfClosing(startElement("d")), tk)
+}
+
+func TestWriteOuterXMLNotAtStartElement(t *testing.T) {
+	// given
+	dec := gosaxml.NewDecoder(strings.NewReader(`<r>text<a/></r>`))
+	var tk gosaxml.Token
+	assert.Nil(t, dec.NextToken(&tk))
+	assert.Nil(t, dec.NextToken(&tk))
+
+	// when
+	err := dec.WriteOuterXML(io.Discard)
+
+	// then
+	assert.Equal(t, gosaxml.ErrNotAtStartElement, err)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestWriteOuterXMLWriterError(t *testing.T) {
+	// given
+	dec := gosaxml.NewDecoder(strings.NewReader(`<r>` + strings.Repeat("<a>text</a>", 1000) + `</r>`))
+	var tk gosaxml.Token
+	assert.Nil(t, dec.NextToken(&tk))
+
+	// when
+	err := dec.WriteOuterXML(failingWriter{})
+
+	// then
+	assert.EqualError(t, err, "write failed")
+}
+
+func TestDecodeLossless(t *testing.T) {
+	// given
+	dec := gosaxml.NewDecoder(strings.NewReader("<a\n b = 'c' /> <d></d\t>"), gosaxml.WithLossless())
+	var tk gosaxml.Token
+
+	// when
+	err1 := dec.NextToken(&tk)
+
+	// then
+	assert.Nil(t, err1)
+	assert.Equal(t, "\n ", string(tk.Attr[0].Space))
+	assert.Equal(t, " = ", string(tk.Attr[0].Eq))
+	assert.Equal(t, " ", string(tk.Space))
+	assert.True(t, tk.SelfClosing)
+	assert.Nil(t, dec.NextToken(&tk))
+	assert.Nil(t, tk.Space)
+	assert.Nil(t, dec.NextToken(&tk))
+	assertTextElement(t, " ", tk)
+	assert.Nil(t, dec.NextToken(&tk))
+	assert.False(t, tk.SelfClosing)
+	assert.Nil(t, dec.NextToken(&tk))
+	assert.Equal(t, "\t", string(tk.Space))
+}
+
+func BenchmarkNextTokenNamespaces(b *testing.B) {
+	// given
+	doc := `<s:Envelope xmlns:s="urn:soap"><s:Body xmlns="urn:app"><a s:b="1"/></s:Body></s:Envelope>`
+	r := strings.NewReader(doc)
+	dec := gosaxml.NewDecoder(r, gosaxml.WithNamespaces())
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		var tk gosaxml.Token
+		r.Reset(doc)
+		dec.Reset(r)
+		for j := 0; j < 6; j++ {
+			assert.Nil(b, dec.NextToken(&tk))
+		}
+	}
+}
+
+func TestDecodeNamespaces(t *testing.T) {
+	// given
+	doc := `<a xmlns="urn:a" xmlns:p="urn:p" x="1" p:y="2" xml:lang="en">` +
+		`<p:b xmlns:p="urn:p2"><c xmlns=""/></p:b>` +
+		`<p:d></p:d><q:e/></a>`
+	dec := gosaxml.NewDecoder(strings.NewReader(doc), gosaxml.WithNamespaces())
+	var names []string
+
+	// when
+	for {
+		var tk gosaxml.Token
+		err := dec.NextToken(&tk)
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		s := fmt.Sprintf("%d %s {%s}", tk.Kind, tk.Name, tk.Name.Namespace)
+		for _, attr := range tk.Attr {
+			s += fmt.Sprintf(" %s {%s}", attr.Name, attr.Name.Namespace)
+		}
+		names = append(names, s)
+	}
+
+	// then
+	assert.Equal(t, []string{
+		"1 a {urn:a} xmlns {http://www.w3.org/2000/xmlns/} xmlns:p {http://www.w3.org/2000/xmlns/} x {} p:y {urn:p} xml:lang {http://www.w3.org/XML/1998/namespace}",
+		"1 p:b {urn:p2} xmlns:p {http://www.w3.org/2000/xmlns/}",
+		"1 c {} xmlns {http://www.w3.org/2000/xmlns/}",
+		"2 c {}",
+		"2 p:b {urn:p2}",
+		"1 p:d {urn:p}",
+		"2 p:d {urn:p}",
+		"1 q:e {}",
+		"2 q:e {}",
+		"2 a {urn:a}",
+	}, names)
+}
+
+func TestDecodeManyNamespaces(t *testing.T) {
+	// given
+	doc := manyAttributes(`xmlns:p%[1]d="urn:a%[1]d"`, 40) + ` xmlns="urn:a">` +
+		manyAttributes(`xmlns:p%[1]d="urn:b%[1]d"`, 40) + ` xmlns=""><p7:b/><c/>` +
+		manyAttributes(`xmlns:q%[1]d="urn:q%[1]d"`, 100) + `><q50:d p7:x="1"/></a></a>` +
+		`<p7:e/>` + manyAttributes(`p%[1]d:x%[1]d="1"`, 40) + `/></a>`
+	dec := gosaxml.NewDecoder(strings.NewReader(doc), gosaxml.WithNamespaceChecks())
+	var names []string
+
+	// when
+	for {
+		var tk gosaxml.Token
+		err := dec.NextToken(&tk)
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		if tk.Kind == gosaxml.TokenTypeStartElement {
+			s := fmt.Sprintf("%s {%s}", tk.Name, tk.Name.Namespace)
+			if len(tk.Attr) > 0 {
+				s += fmt.Sprintf(" %s {%s}", tk.Attr[len(tk.Attr)-1].Name, tk.Attr[len(tk.Attr)-1].Name.Namespace)
+			}
+			names = append(names, s)
+		}
+	}
+
+	// then
+	assert.Equal(t, []string{
+		"a {urn:a} xmlns {http://www.w3.org/2000/xmlns/}",
+		"a {} xmlns {http://www.w3.org/2000/xmlns/}",
+		"p7:b {urn:b7}",
+		"c {}",
+		"a {} xmlns:q99 {http://www.w3.org/2000/xmlns/}",
+		"q50:d {urn:q50} p7:x {urn:b7}",
+		"p7:e {urn:a7}",
+		"a {urn:a} p39:x39 {urn:a39}",
+	}, names)
+}
+
+func TestDecodeNamespacesDisabled(t *testing.T) {
+	// given
+	dec := gosaxml.NewDecoder(strings.NewReader(`<a xmlns="urn:a"/>`))
+	var tk gosaxml.Token
+
+	// when
+	err := dec.NextToken(&tk)
+
+	// then
+	assert.Nil(t, err)
+	assert.Nil(t, tk.Name.Namespace)
+}
+
+func TestDecodeNamespaceChecks(t *testing.T) {
+	for doc, category := range map[string]error{
+		`<p:a xmlns:p="urn:p" p:b="1" xml:lang="en"><p:c/></p:a>`: nil,
+		`<a xmlns:p="urn:p"><b xmlns:p="urn:q" p:c="1"/></a>`:     nil,
+		`<a xmlns:xml="http://www.w3.org/XML/1998/namespace"/>`:   nil,
+		`<a xmlns:p="urn:p" xmlns:q="urn:q" p:b="1" q:b="2"/>`:    nil,
+		`<p:a/>`:                     gosaxml.ErrUndeclaredPrefix,
+		`<a p:b="1"/>`:               gosaxml.ErrUndeclaredPrefix,
+		`<a xmlns:p="urn:p"/><p:b/>`: gosaxml.ErrUndeclaredPrefix,
+		`<a xmlns:xmlns="urn:x"/>`:   gosaxml.ErrReservedNamespace,
+		`<a xmlns:xml="urn:x"/>`:     gosaxml.ErrReservedNamespace,
+		`<a xmlns:p="http://www.w3.org/XML/1998/namespace"/>`: gosaxml.ErrReservedNamespace,
+		`<a xmlns="http://www.w3.org/2000/xmlns/"/>`:          gosaxml.ErrReservedNamespace,
+		`<xmlns:a/>`:       gosaxml.ErrReservedNamespace,
+		`<a xmlns:p=""/>`:  gosaxml.ErrEmptyNamespace,
+		`<a b="1" b="2"/>`: gosaxml.ErrDuplicateAttribute,
+		`<a xmlns:p="urn:p" xmlns:q="urn:p" p:b="1" q:b="2"/>`: gosaxml.ErrDuplicateAttribute,
+	} {
+		// when
+		_, err := decodeTokens(doc, gosaxml.WithNamespaceChecks())
+
+		// then
+		if category == nil {
+			assert.Nil(t, err, doc)
+		} else {
+			assert.ErrorIs(t, err, category, doc)
+		}
+	}
+}
+
+func TestDecodeNamespaceChecksManyAttributes(t *testing.T) {
+	for doc, category := range map[string]error{
+		manyAttributes(`x%d="1"`, 50000) + ` xmlns:p="urn:p" p:x0="2"/>`:                                            nil,
+		manyAttributes(`x%d="1"`, 50000) + ` xmlns:p="urn:p" xmlns:q="urn:p" p:x="2"/>`:                             nil,
+		manyAttributes(`x%d="1"`, 50000) + ` xmlns:p="urn:p" p:x="2" q:x="3"/>`:                                     gosaxml.ErrUndeclaredPrefix,
+		manyAttributes(`x%d="1"`, 50000) + ` xmlns:p="urn:p" xmlns:q="urn:p" p:x="2" q:x="3"/>`:                     gosaxml.ErrDuplicateAttribute,
+		manyAttributes(`x%d="1"`, 50000) + ` x49999="2"/>`:                                                          gosaxml.ErrDuplicateAttribute,
+		manyAttributes(`xmlns:p%[1]d="urn:p%[1]d" p%[1]d:x="1"`, 50000) + `/>`:                                      nil,
+		manyAttributes(`xmlns:p%[1]d="urn:p%[1]d"`, 50000) + `>` + manyAttributes(`p%[1]d:x="1"`, 50000) + `/></a>`: nil,
+	} {
+		// when
+		_, err := decodeTokens(doc, gosaxml.WithNamespaceChecks())
+
+		// then
+		if category == nil {
+			assert.Nil(t, err)
+		} else {
+			assert.ErrorIs(t, err, category)
+		}
+	}
+}
+
+func TestDecodeNamespaceChecksDisabled(t *testing.T) {
+	// when
+	_, err := decodeTokens(`<p:a b="1" b="2"/>`, gosaxml.WithNamespaces())
+
+	// then
+	assert.Nil(t, err)
+}
+
 func TestInputOffset(t *testing.T) {
 	// given
 	var tk gosaxml.Token
@@ -250,11 +1114,187 @@ func TestInputOffset(t *testing.T) {
 	assert.Equal(t, lastOffset, off3)
 }
 
+func TestSyntaxErrorPosition(t *testing.T) {
+	// given
+	doc := "<a>\n  <b:c>\n    <d e=\"1\" f/>\n  </b:c>\n</a>"
+	dec := gosaxml.NewDecoder(strings.NewReader(doc), gosaxml.WithPositionTracking())
+	var tk gosaxml.Token
+
+	// when
+	var err error
+	for err == nil {
+		err = dec.NextToken(&tk)
+	}
+
+	// then
+	var syntaxErr *gosaxml.SyntaxError
+	assert.True(t, errors.As(err, &syntaxErr))
+	assert.True(t, errors.Is(err, gosaxml.ErrInvalidAttribute))
+	assert.Equal(t, "expected '=' character following attribute f", syntaxErr.Msg)
+	assert.Equal(t, 3, syntaxErr.Line)
+	assert.Equal(t, 16, syntaxErr.Column)
+	assert.Equal(t, 27, syntaxErr.Offset)
+	assert.Equal(t, "/a/b:c/d", syntaxErr.Path)
+	assert.Equal(t, "expected '=' character following attribute f (line 3, column 16, offset 27, path /a/b:c/d)", err.Error())
+}
+
+func TestSyntaxErrorWithoutPositionTracking(t *testing.T) {
+	// given
+	doc := "<a>\n  <b:c>\n    <d e=\"1\" f/>\n  </b:c>\n</a>"
+	dec := gosaxml.NewDecoder(strings.NewReader(doc))
+	var tk gosaxml.Token
+
+	// when
+	var err error
+	for err == nil {
+		err = dec.NextToken(&tk)
+	}
+
+	// then
+	var syntaxErr *gosaxml.SyntaxError
+	assert.True(t, errors.As(err, &syntaxErr))
+	assert.Equal(t, 0, syntaxErr.Line)
+	assert.Equal(t, 0, syntaxErr.Column)
+	assert.Equal(t, 27, syntaxErr.Offset)
+	assert.Equal(t, "expected '=' character following attribute f (offset 27, path /a/b:c/d)", err.Error())
+}
+
+func TestSyntaxErrorLineAfterBufferRefills(t *testing.T) {
+	// given
+	doc := "<a>" + strings.Repeat("\n<b/>", 1000) + "\n <c d=e/></a>"
+	dec := gosaxml.NewDecoder(strings.NewReader(doc), gosaxml.WithPositionTracking())
+	var tk gosaxml.Token
+
+	// when
+	var err error
+	for err == nil {
+		err = dec.NextToken(&tk)
+	}
+
+	// then
+	var syntaxErr *gosaxml.SyntaxError
+	assert.True(t, errors.As(err, &syntaxErr))
+	assertSyntaxError(t, err, gosaxml.ErrInvalidAttribute, "expected quoted value of attribute d")
+	assert.Equal(t, 1002, syntaxErr.Line)
+	assert.Equal(t, 8, syntaxErr.Column)
+	assert.Equal(t, "/a/c", syntaxErr.Path)
+}
+
+func TestPositionTracking(t *testing.T) {
+	// given
+	doc := "<?xml version=\"1.0\"?>\n<a>\n  <b x=\"1\"/>text\n</a>"
+	dec := gosaxml.NewDecoder(strings.NewReader(doc), gosaxml.WithPositionTracking())
+	var tk gosaxml.Token
+	var positions []gosaxml.Position
+
+	// when
+	for {
+		err := dec.NextToken(&tk)
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		positions = append(positions, dec.Position())
+	}
+
+	// then
+	assert.Equal(t, []gosaxml.Position{
+		{Offset: 0, Line: 1, Column: 1},   // <?xml
+		{Offset: 22, Line: 2, Column: 1},  // <a>
+		{Offset: 28, Line: 3, Column: 3},  // <b
+		{Offset: 38, Line: 3, Column: 13}, // end of <b/>
+		{Offset: 38, Line: 3, Column: 13}, // text
+		{Offset: 43, Line: 4, Column: 1},  // </a>
+	}, positions)
+}
+
+func TestPositionTrackingChunked(t *testing.T) {
+	// given
+	rd := &chunkReader{
+		[]byte("<a>\n\n"),
+		[]byte("\n <b"),
+		[]byte("/>\n"),
+		[]byte("</a>"),
+	}
+	dec := gosaxml.NewDecoder(rd, gosaxml.WithPositionTracking())
+	var tk gosaxml.Token
+
+	// when/then
+	assert.Nil(t, dec.NextToken(&tk))
+	assert.Equal(t, gosaxml.Position{Offset: 0, Line: 1, Column: 1}, dec.Position())
+	assert.Nil(t, dec.NextToken(&tk))
+	assert.Equal(t, gosaxml.Position{Offset: 7, Line: 4, Column: 2}, dec.Position())
+	assert.Nil(t, dec.NextToken(&tk))
+	assert.Equal(t, gosaxml.Position{Offset: 11, Line: 4, Column: 6}, dec.Position())
+	assert.Nil(t, dec.NextToken(&tk))
+	assert.Equal(t, gosaxml.Position{Offset: 12, Line: 5, Column: 1}, dec.Position())
+}
+
+func TestTokenOffsets(t *testing.T) {
+	for _, doc := range []string{
+		"<?pi data ?><!DOCTYPE a><a x='>'>\n t<b/><c >text</c ><![CDATA[x]]><!--y--><?q?></a >",
+		strings.Repeat("<a b=\"123\">some text</a>", 200),
+	} {
+		// given
+		rd := chunkReader{}
+		for i := 0; i < len(doc); i += 7 {
+			rd = append(rd, []byte(doc[i:min(i+7, len(doc))]))
+		}
+		dec := gosaxml.NewDecoder(&rd, gosaxml.WithComments())
+		var tk gosaxml.Token
+		var sources []string
+
+		// when
+		for {
+			err := dec.NextToken(&tk)
+			if err == io.EOF {
+				break
+			}
+			assert.Nil(t, err)
+			start, end := dec.TokenOffsets()
+			sources = append(sources, doc[start:end])
+		}
+
+		// then
+		assert.Equal(t, doc, strings.Join(sources, ""))
+		if strings.HasPrefix(doc, "<?pi") {
+			assert.Equal(t, []string{"<?pi data ?>", "<!DOCTYPE a>", "<a x='>'>", "\n t", "<b/>", "", "<c >", "text", "</c >",
+				"<![CDATA[x]]>", "<!--y-->", "<?q?>", "</a >"}, sources)
+		}
+	}
+}
+
+func TestPositionTrackingDisabled(t *testing.T) {
+	// given
+	dec := gosaxml.NewDecoder(strings.NewReader("\n<a/>"))
+	var tk gosaxml.Token
+
+	// when
+	err := dec.NextToken(&tk)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, gosaxml.Position{}, dec.Position())
+}
+
+func assertSyntaxError(t *testing.T, err error, category error, msg string) {
+	var syntaxErr *gosaxml.SyntaxError
+	if assert.True(t, errors.As(err, &syntaxErr), "expected SyntaxError but got %v", err) {
+		assert.ErrorIs(t, err, category)
+		assert.Equal(t, msg, syntaxErr.Msg)
+	}
+}
+
 func assertTextElement(t *testing.T, text string, token gosaxml.Token) {
 	assert.Equal(t, uint8(gosaxml.TokenTypeTextElement), token.Kind)
 	assert.Equal(t, []byte(text), token.ByteData)
 }
 
+func assertCharData(t *testing.T, text string, token gosaxml.Token) {
+	assert.Equal(t, uint8(gosaxml.TokenTypeCharData), token.Kind)
+	assert.Equal(t, []byte(text), token.ByteData)
+}
+
 func assertEndElement(t *testing.T, local string, token gosaxml.Token) {
 	assert.Equal(t, uint8(gosaxml.TokenTypeEndElement), token.Kind)
 	assert.Equal(t, []byte(local), token.Name.Local)
@@ -270,6 +1310,11 @@ func startElement(local string) gosaxml.Token {
 	}
 }
 
+func selfClosing(tk gosaxml.Token) gosaxml.Token {
+	tk.SelfClosing = true
+	return tk
+}
+
 func startElementWithPrefix(prefix, local string) gosaxml.Token {
 	return gosaxml.Token{
 		Kind: gosaxml.TokenTypeStartElement,
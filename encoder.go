@@ -1,6 +1,7 @@
 package gosaxml
 
 import (
+	"bytes"
 	"errors"
 	"io"
 )
@@ -14,7 +15,31 @@ var (
 	slashAngleClose = []byte("/>")
 	angleOpenSlash  = []byte("</")
 	angleOpenQuest  = []byte("<?")
+	angleOpenExcl   = []byte("<!")
 	questAngleClose = []byte("?>")
+	cdataOpen       = []byte("<![CDATA[")
+	cdataClose      = []byte("]]>")
+	cdataSplit      = []byte("]]]]><![CDATA[>")
+	commentOpen     = []byte("<!--")
+	commentClose    = []byte("-->")
+	doubleDash      = []byte("--")
+)
+
+// EmptyElementStyle determines how an Encoder writes
+// elements without any content.
+type EmptyElementStyle byte
+
+// constants for Encoder.EmptyElementStyle
+const (
+	// EmptyElementCollapse writes empty elements as "<a/>".
+	EmptyElementCollapse EmptyElementStyle = iota
+
+	// EmptyElementExpand writes empty elements as "<a></a>".
+	EmptyElementExpand
+
+	// EmptyElementPreserve writes empty elements as "<a/>" if their
+	// start element Token is SelfClosing and as "<a></a>" otherwise.
+	EmptyElementPreserve
 )
 
 // EncoderMiddleware allows to pre-process a Token before
@@ -49,10 +74,49 @@ type Encoder struct {
 	// The io.Writer we encode/write into.
 	wr io.Writer
 
+	// Escape makes the Encoder escape the values of attributes and the
+	// data of text elements using AppendEscapedAttr and AppendEscapedText.
+	// This must be enabled when tokens contain unescaped data, like tokens
+	// built from arbitrary strings or decoded with WithEntityDecoding.
+	// By default, values are written verbatim.
+	Escape bool
+
+	// Lossless makes the Encoder reproduce the formatting recorded by a
+	// Decoder in lossless mode (see WithLossless): the whitespace inside of
+	// tags, "<a></a>" instead of "<a/>" for elements that were not
+	// self-closing (see EmptyElementStyle) and the verbatim data of
+	// processing instructions.
+	// Tokens without recorded whitespace are encoded as usual.
+	Lossless bool
+
+	// EmptyElementStyle determines how elements without any content are
+	// written. It defaults to EmptyElementCollapse, except in lossless mode,
+	// which always preserves the original style.
+	EmptyElementStyle EmptyElementStyle
+
+	// Charset makes the Encoder write its output in the given single-byte
+	// character set (see LookupCharset) instead of UTF-8. Characters which
+	// it cannot represent are written as character references in texts and
+	// attribute values and between two CDATA sections in CDATA sections.
+	// Elsewhere, they result in ErrUnmappableCharacter.
+	// The Encoder does not write an XML declaration for the Charset.
+	Charset *Charset
+
+	// holds escaped values to be written in the Charset
+	escaped []byte
+
+	// Whether any token or declaration was encoded.
+	started bool
+
 	// Whether the last token was of type TokenTypeStartElement.
 	// This is used to delay encoding the ending ">" or "/>" string
 	// based on whether the element is immediately closed afterwards.
 	lastStartElement bool
+
+	// The Space and SelfClosing of the last StartElement,
+	// to be used when ending it.
+	lastSpace       []byte
+	lastSelfClosing bool
 }
 
 // NewEncoder creates a new Encoder with the given middlewares and returns a pointer to it.
@@ -96,12 +160,58 @@ func (thiz *Encoder) writeBytes(bs []byte) error {
 	return nil
 }
 
+// writeData writes bs in the Charset, if any, handling
+// unmappable characters according to mode (see appendCharset).
+func (thiz *Encoder) writeData(bs []byte, mode int) error {
+	if thiz.Charset == nil {
+		return thiz.writeBytes(bs)
+	}
+	if len(thiz.buf)+len(bs) >= cap(thiz.buf) {
+		err := thiz.Flush()
+		if err != nil {
+			return err
+		}
+	}
+	var err error
+	thiz.buf, err = appendCharset(thiz.buf, bs, thiz.Charset, mode)
+	return err
+}
+
+// writeEscaped writes the escaped form of an attribute value or text.
+func (thiz *Encoder) writeEscaped(bs []byte, attr, singleQuote bool) error {
+	if len(thiz.buf)+len(bs) >= cap(thiz.buf) {
+		err := thiz.Flush()
+		if err != nil {
+			return err
+		}
+	}
+	dst := thiz.buf
+	if thiz.Charset != nil {
+		dst = thiz.escaped[:0]
+	}
+	if attr {
+		dst = AppendEscapedAttr(dst, bs, singleQuote)
+	} else {
+		dst = AppendEscapedText(dst, bs)
+	}
+	if thiz.Charset == nil {
+		thiz.buf = dst
+		return nil
+	}
+	thiz.escaped = dst
+	var err error
+	thiz.buf, err = appendCharset(thiz.buf, dst, thiz.Charset, unmappableReference)
+	return err
+}
+
 // Reset resets this Encoder to write into the provided io.Writer
 // and resets all middlewares.
 func (thiz *Encoder) Reset(w io.Writer) {
 	thiz.wr = w
 	thiz.buf = thiz.buf[:0]
+	thiz.started = false
 	thiz.lastStartElement = false
+	thiz.lastSpace = nil
 	for _, middleware := range thiz.middlewares {
 		middleware.Reset()
 	}
@@ -111,6 +221,7 @@ func (thiz *Encoder) Reset(w io.Writer) {
 // writes the byte-representation of that Token to the io.Writer
 // of this Encoder.
 func (thiz *Encoder) EncodeToken(t *Token) error {
+	thiz.started = true
 	switch t.Kind {
 	case TokenTypeInvalid:
 		return errors.New("trying to encode invalid/zerovalue token")
@@ -120,6 +231,8 @@ func (thiz *Encoder) EncodeToken(t *Token) error {
 			return err
 		}
 		thiz.lastStartElement = true
+		thiz.lastSpace = t.Space
+		thiz.lastSelfClosing = t.SelfClosing
 	case TokenTypeEndElement:
 		err := thiz.encodeEndElement(t)
 		if err != nil {
@@ -144,6 +257,18 @@ func (thiz *Encoder) EncodeToken(t *Token) error {
 			return err
 		}
 		thiz.lastStartElement = false
+	case TokenTypeCharData:
+		err := thiz.encodeCharData(t)
+		if err != nil {
+			return err
+		}
+		thiz.lastStartElement = false
+	case TokenTypeComment:
+		err := thiz.encodeComment(t)
+		if err != nil {
+			return err
+		}
+		thiz.lastStartElement = false
 	default:
 		thiz.lastStartElement = false
 		return errors.New("NYI")
@@ -152,16 +277,17 @@ func (thiz *Encoder) EncodeToken(t *Token) error {
 }
 
 func (thiz *Encoder) encodeStartElement(t *Token) error {
-	err := thiz.endLastStartElement()
+	// call the middlewares first, so that nothing
+	// is written for an element one of them rejects
+	err := thiz.callMiddlewares(t)
 	if err != nil {
 		return err
 	}
-	err = thiz.write('<')
+	err = thiz.endLastStartElement()
 	if err != nil {
 		return err
 	}
-
-	err = thiz.callMiddlewares(t)
+	err = thiz.write('<')
 	if err != nil {
 		return err
 	}
@@ -175,7 +301,11 @@ func (thiz *Encoder) encodeStartElement(t *Token) error {
 	// write attributes
 	for i := 0; i < len(t.Attr); i++ {
 		attr := &t.Attr[i]
-		err = thiz.write(' ')
+		if thiz.Lossless && len(attr.Space) > 0 {
+			err = thiz.writeBytes(attr.Space)
+		} else {
+			err = thiz.write(' ')
+		}
 		if err != nil {
 			return err
 		}
@@ -183,7 +313,11 @@ func (thiz *Encoder) encodeStartElement(t *Token) error {
 		if err != nil {
 			return err
 		}
-		err = thiz.write('=')
+		if thiz.Lossless && len(attr.Eq) > 0 {
+			err = thiz.writeBytes(attr.Eq)
+		} else {
+			err = thiz.write('=')
+		}
 		if err != nil {
 			return err
 		}
@@ -200,17 +334,25 @@ func (thiz *Encoder) encodeStartElement(t *Token) error {
 }
 
 func (thiz *Encoder) encodeEndElement(t *Token) error {
-	if thiz.lastStartElement {
+	if thiz.lastStartElement && thiz.collapse() {
 		// the last seen token was a StartElement, so this
 		// token can only be its accompanying EndElement.
-		err := thiz.writeBytes(slashAngleClose)
+		err := thiz.writeLastSpace()
+		if err != nil {
+			return err
+		}
+		err = thiz.writeBytes(slashAngleClose)
 		if err != nil {
 			return err
 		}
 		return thiz.callMiddlewares(t)
 	}
 
-	err := thiz.callMiddlewares(t)
+	err := thiz.endLastStartElement()
+	if err != nil {
+		return err
+	}
+	err = thiz.callMiddlewares(t)
 	if err != nil {
 		return err
 	}
@@ -222,6 +364,12 @@ func (thiz *Encoder) encodeEndElement(t *Token) error {
 	if err != nil {
 		return err
 	}
+	if thiz.Lossless {
+		err = thiz.writeBytes(t.Space)
+		if err != nil {
+			return err
+		}
+	}
 	err = thiz.write('>')
 	if err != nil {
 		return err
@@ -243,7 +391,7 @@ func (thiz *Encoder) callMiddlewares(t *Token) error {
 func (thiz *Encoder) writeName(n Name) error {
 	var err error
 	if n.Prefix != nil {
-		err = thiz.writeBytes(n.Prefix)
+		err = thiz.writeData(n.Prefix, unmappableError)
 		if err != nil {
 			return err
 		}
@@ -252,7 +400,7 @@ func (thiz *Encoder) writeName(n Name) error {
 			return err
 		}
 	}
-	return thiz.writeBytes(n.Local)
+	return thiz.writeData(n.Local, unmappableError)
 }
 
 func (thiz *Encoder) writeString(s []byte, useSingleQuote bool) error {
@@ -265,7 +413,11 @@ func (thiz *Encoder) writeString(s []byte, useSingleQuote bool) error {
 	if err != nil {
 		return err
 	}
-	err = thiz.writeBytes(s)
+	if thiz.Escape {
+		err = thiz.writeEscaped(s, true, useSingleQuote)
+	} else {
+		err = thiz.writeData(s, unmappableReference)
+	}
 	if err != nil {
 		return err
 	}
@@ -282,13 +434,74 @@ func (thiz *Encoder) encodeTextElement(t *Token) error {
 	if err != nil {
 		return err
 	}
-	return thiz.writeBytes(t.ByteData)
+	if thiz.Escape {
+		return thiz.writeEscaped(t.ByteData, false, false)
+	}
+	return thiz.writeData(t.ByteData, unmappableReference)
+}
+
+// encodeCharData writes the token's data as a CDATA section.
+// Any "]]>" in the data is split across two adjacent CDATA sections,
+// because it would otherwise prematurely terminate the section.
+func (thiz *Encoder) encodeCharData(t *Token) error {
+	err := thiz.endLastStartElement()
+	if err != nil {
+		return err
+	}
+	err = thiz.writeBytes(cdataOpen)
+	if err != nil {
+		return err
+	}
+	data := t.ByteData
+	for {
+		k := bytes.Index(data, cdataClose)
+		if k < 0 {
+			break
+		}
+		err = thiz.writeData(data[:k], unmappableCDATA)
+		if err != nil {
+			return err
+		}
+		err = thiz.writeBytes(cdataSplit)
+		if err != nil {
+			return err
+		}
+		data = data[k+len(cdataClose):]
+	}
+	err = thiz.writeData(data, unmappableCDATA)
+	if err != nil {
+		return err
+	}
+	return thiz.writeBytes(cdataClose)
+}
+
+func (thiz *Encoder) encodeComment(t *Token) error {
+	if bytes.Contains(t.ByteData, doubleDash) || bytes.HasSuffix(t.ByteData, doubleDash[:1]) {
+		return errors.New("comment must not contain \"--\" or end with \"-\"")
+	}
+	err := thiz.endLastStartElement()
+	if err != nil {
+		return err
+	}
+	err = thiz.writeBytes(commentOpen)
+	if err != nil {
+		return err
+	}
+	err = thiz.writeData(t.ByteData, unmappableError)
+	if err != nil {
+		return err
+	}
+	return thiz.writeBytes(commentClose)
 }
 
 func (thiz *Encoder) endLastStartElement() error {
 	if thiz.lastStartElement {
 		// end the last StartElement with its ">"
-		err := thiz.write('>')
+		err := thiz.writeLastSpace()
+		if err != nil {
+			return err
+		}
+		err = thiz.write('>')
 		if err != nil {
 			return err
 		}
@@ -296,12 +509,50 @@ func (thiz *Encoder) endLastStartElement() error {
 	return nil
 }
 
+// collapse reports whether the last StartElement,
+// which is closed right away, is to be written as "<a/>".
+func (thiz *Encoder) collapse() bool {
+	if thiz.Lossless {
+		return thiz.lastSelfClosing
+	}
+	switch thiz.EmptyElementStyle {
+	case EmptyElementExpand:
+		return false
+	case EmptyElementPreserve:
+		return thiz.lastSelfClosing
+	default:
+		return true
+	}
+}
+
+// writeLastSpace writes the whitespace before the end of the
+// last StartElement in lossless mode.
+func (thiz *Encoder) writeLastSpace() error {
+	if !thiz.Lossless {
+		return nil
+	}
+	return thiz.writeBytes(thiz.lastSpace)
+}
+
 func (thiz *Encoder) encodeDirective(t *Token) error {
 	err := thiz.endLastStartElement()
 	if err != nil {
 		return err
 	}
-	return thiz.writeBytes(t.ByteData)
+	if bytes.HasPrefix(t.ByteData, angleOpenExcl) {
+		// tokens created before the decoder produced directives
+		// contain the delimiters themselves
+		return thiz.writeData(t.ByteData, unmappableError)
+	}
+	err = thiz.writeBytes(angleOpenExcl)
+	if err != nil {
+		return err
+	}
+	err = thiz.writeData(t.ByteData, unmappableError)
+	if err != nil {
+		return err
+	}
+	return thiz.write('>')
 }
 
 func (thiz *Encoder) encodeProcInst(t *Token) error {
@@ -317,11 +568,13 @@ func (thiz *Encoder) encodeProcInst(t *Token) error {
 	if err != nil {
 		return err
 	}
-	err = thiz.write(' ')
-	if err != nil {
-		return err
+	if !thiz.Lossless || len(t.ByteData) > 0 && !isWhitespace(t.ByteData[0]) {
+		err = thiz.write(' ')
+		if err != nil {
+			return err
+		}
 	}
-	err = thiz.writeBytes(t.ByteData)
+	err = thiz.writeData(t.ByteData, unmappableError)
 	if err != nil {
 		return err
 	}
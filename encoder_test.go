@@ -2,6 +2,7 @@ package gosaxml_test
 
 import (
 	"bytes"
+	"fmt"
 	"github.com/HBTGmbH/gosaxml"
 	"github.com/stretchr/testify/assert"
 	"io"
@@ -246,3 +247,269 @@ func TestEncodeTwoNestedWithRedundantNamespaceUnprefixed(t *testing.T) {
 	assert.Nil(t, err2)
 	assert.Equal(t, "<a xmlns=\"https://mynamespace\"><b", w.String())
 }
+
+func TestEncodeCharData(t *testing.T) {
+	// given
+	w := &bytes.Buffer{}
+	enc := gosaxml.NewEncoder(w)
+
+	// when
+	err1 := enc.EncodeToken(&gosaxml.Token{
+		Kind: gosaxml.TokenTypeStartElement,
+		Name: gosaxml.Name{
+			Local: []byte("a"),
+		},
+	})
+	err2 := enc.EncodeToken(&gosaxml.Token{
+		Kind:     gosaxml.TokenTypeCharData,
+		ByteData: []byte("<b> & c"),
+	})
+	err3 := enc.EncodeToken(&gosaxml.Token{
+		Kind: gosaxml.TokenTypeEndElement,
+		Name: gosaxml.Name{
+			Local: []byte("a"),
+		},
+	})
+	assert.Nil(t, enc.Flush())
+
+	// then
+	assert.Nil(t, err1)
+	assert.Nil(t, err2)
+	assert.Nil(t, err3)
+	assert.Equal(t, "<a><![CDATA[<b> & c]]></a>", w.String())
+}
+
+func TestEncodeCharDataWithTerminator(t *testing.T) {
+	// given
+	w := &bytes.Buffer{}
+	enc := gosaxml.NewEncoder(w)
+
+	// when
+	err := enc.EncodeToken(&gosaxml.Token{
+		Kind:     gosaxml.TokenTypeCharData,
+		ByteData: []byte("a]]>b]]>"),
+	})
+	assert.Nil(t, enc.Flush())
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "<![CDATA[a]]]]><![CDATA[>b]]]]><![CDATA[>]]>", w.String())
+}
+
+func TestEncodeComment(t *testing.T) {
+	// given
+	w := &bytes.Buffer{}
+	enc := gosaxml.NewEncoder(w)
+
+	// when
+	err := enc.EncodeToken(&gosaxml.Token{
+		Kind:     gosaxml.TokenTypeComment,
+		ByteData: []byte(" a - b "),
+	})
+	assert.Nil(t, enc.Flush())
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "<!-- a - b -->", w.String())
+}
+
+func TestEncodeInvalidComment(t *testing.T) {
+	// given
+	enc := gosaxml.NewEncoder(io.Discard)
+
+	// when
+	err1 := enc.EncodeToken(&gosaxml.Token{
+		Kind:     gosaxml.TokenTypeComment,
+		ByteData: []byte(" a -- b "),
+	})
+	err2 := enc.EncodeToken(&gosaxml.Token{
+		Kind:     gosaxml.TokenTypeComment,
+		ByteData: []byte(" a -"),
+	})
+
+	// then
+	assert.EqualError(t, err1, "comment must not contain \"--\" or end with \"-\"")
+	assert.EqualError(t, err2, "comment must not contain \"--\" or end with \"-\"")
+}
+
+func TestAppendEscapedText(t *testing.T) {
+	assert.Equal(t, "a&lt;b&gt; &amp;&#xD;\n'\"", string(gosaxml.AppendEscapedText(nil, []byte("a<b> &\r\n'\""))))
+	assert.Equal(t, "x:plain", string(gosaxml.AppendEscapedText([]byte("x:"), []byte("plain"))))
+}
+
+func TestAppendEscapedAttr(t *testing.T) {
+	assert.Equal(t, "&lt;&amp;>'&quot;&#x9;&#xA;&#xD;", string(gosaxml.AppendEscapedAttr(nil, []byte("<&>'\"\t\n\r"), false)))
+	assert.Equal(t, "&lt;&amp;>&apos;\"", string(gosaxml.AppendEscapedAttr(nil, []byte("<&>'\""), true)))
+}
+
+func BenchmarkAppendEscapedText(b *testing.B) {
+	src := []byte("Fish & Chips <with> \"salt\" & vinegar")
+	dst := make([]byte, 0, 256)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		dst = gosaxml.AppendEscapedText(dst[:0], src)
+	}
+}
+
+func TestEncodeEscaped(t *testing.T) {
+	// given
+	w := &bytes.Buffer{}
+	enc := gosaxml.NewEncoder(w)
+	enc.Escape = true
+
+	// when
+	err1 := enc.EncodeToken(&gosaxml.Token{
+		Kind: gosaxml.TokenTypeStartElement,
+		Name: gosaxml.Name{
+			Local: []byte("a"),
+		},
+		Attr: []gosaxml.Attr{{
+			Name: gosaxml.Name{
+				Local: []byte("b"),
+			},
+			Value: []byte(`"it's"`),
+		}, {
+			Name: gosaxml.Name{
+				Local: []byte("c"),
+			},
+			Value:       []byte(`"it's"`),
+			SingleQuote: true,
+		}},
+	})
+	err2 := enc.EncodeToken(&gosaxml.Token{
+		Kind:     gosaxml.TokenTypeTextElement,
+		ByteData: []byte("1 < 2 & 3 > 2"),
+	})
+	err3 := enc.EncodeToken(&gosaxml.Token{
+		Kind: gosaxml.TokenTypeEndElement,
+		Name: gosaxml.Name{
+			Local: []byte("a"),
+		},
+	})
+	assert.Nil(t, enc.Flush())
+
+	// then
+	assert.Nil(t, err1)
+	assert.Nil(t, err2)
+	assert.Nil(t, err3)
+	assert.Equal(t, `<a b="&quot;it's&quot;" c='"it&apos;s"'>1 &lt; 2 &amp; 3 &gt; 2</a>`, w.String())
+}
+
+func TestEncodeWithNamespaceChecks(t *testing.T) {
+	// given
+	w := &bytes.Buffer{}
+	nm := gosaxml.NewNamespaceModifier()
+	nm.CheckNamespaces = true
+	enc := gosaxml.NewEncoder(w, nm)
+	declaring := gosaxml.Token{
+		Kind: gosaxml.TokenTypeStartElement,
+		Name: gosaxml.Name{Local: []byte("a"), Prefix: []byte("p")},
+		Attr: []gosaxml.Attr{{
+			Name:  gosaxml.Name{Local: []byte("p"), Prefix: []byte("xmlns")},
+			Value: []byte("urn:p"),
+		}},
+	}
+	using := gosaxml.Token{
+		Kind: gosaxml.TokenTypeStartElement,
+		Name: gosaxml.Name{Local: []byte("b"), Prefix: []byte("p")},
+	}
+	undeclared := gosaxml.Token{
+		Kind: gosaxml.TokenTypeStartElement,
+		Name: gosaxml.Name{Local: []byte("c"), Prefix: []byte("q")},
+	}
+
+	// when
+	err1 := enc.EncodeToken(&declaring)
+	err2 := enc.EncodeToken(&using)
+	err3 := enc.EncodeToken(&undeclared)
+
+	// then
+	assert.Nil(t, err1)
+	assert.Nil(t, err2)
+	assert.ErrorIs(t, err3, gosaxml.ErrUndeclaredPrefix)
+	assert.EqualError(t, err3, "undeclared namespace prefix: namespace prefix of element q:c is not declared")
+}
+
+func TestEncodeWithNamespaceChecksManyAttributes(t *testing.T) {
+	// given
+	nm := gosaxml.NewNamespaceModifier()
+	nm.CheckNamespaces = true
+	enc := gosaxml.NewEncoder(&bytes.Buffer{}, nm)
+	attrs := make([]gosaxml.Attr, 50000)
+	for i := range attrs {
+		attrs[i] = gosaxml.Attr{Name: gosaxml.Name{Local: []byte(fmt.Sprintf("x%d", i))}, Value: []byte("1")}
+	}
+	duplicate := append(attrs[:len(attrs):len(attrs)], gosaxml.Attr{Name: gosaxml.Name{Local: []byte("x0")}, Value: []byte("2")})
+
+	// when
+	err1 := enc.EncodeToken(&gosaxml.Token{Kind: gosaxml.TokenTypeStartElement, Name: gosaxml.Name{Local: []byte("a")}, Attr: attrs})
+	err2 := enc.EncodeToken(&gosaxml.Token{Kind: gosaxml.TokenTypeStartElement, Name: gosaxml.Name{Local: []byte("b")}, Attr: duplicate})
+
+	// then
+	assert.Nil(t, err1)
+	assert.ErrorIs(t, err2, gosaxml.ErrDuplicateAttribute)
+}
+
+func TestEncodeAfterFailedNamespaceCheck(t *testing.T) {
+	// given
+	w := &bytes.Buffer{}
+	nm := gosaxml.NewNamespaceModifier()
+	nm.CheckNamespaces = true
+	nm.PreserveOriginalPrefixes = true
+	enc := gosaxml.NewEncoder(w, nm)
+	declaring := gosaxml.Token{
+		Kind: gosaxml.TokenTypeStartElement,
+		Name: gosaxml.Name{Local: []byte("a"), Prefix: []byte("p")},
+		Attr: []gosaxml.Attr{{
+			Name:  gosaxml.Name{Local: []byte("p"), Prefix: []byte("xmlns")},
+			Value: []byte("urn:p"),
+		}},
+	}
+	undeclared := gosaxml.Token{
+		Kind: gosaxml.TokenTypeStartElement,
+		Name: gosaxml.Name{Local: []byte("c"), Prefix: []byte("q")},
+	}
+	using := gosaxml.Token{
+		Kind: gosaxml.TokenTypeStartElement,
+		Name: gosaxml.Name{Local: []byte("b"), Prefix: []byte("p")},
+	}
+	assert.Nil(t, enc.EncodeToken(&declaring))
+	assert.ErrorIs(t, enc.EncodeToken(&undeclared), gosaxml.ErrUndeclaredPrefix)
+
+	// when
+	err1 := enc.EncodeToken(&using)
+	err2 := enc.EncodeToken(&gosaxml.Token{Kind: gosaxml.TokenTypeEndElement, Name: using.Name})
+	err3 := enc.EncodeToken(&gosaxml.Token{Kind: gosaxml.TokenTypeEndElement, Name: declaring.Name})
+	err4 := enc.EncodeToken(&using)
+	assert.Nil(t, enc.Flush())
+
+	// then
+	assert.Nil(t, err1)
+	assert.Nil(t, err2)
+	assert.Nil(t, err3)
+	assert.ErrorIs(t, err4, gosaxml.ErrUndeclaredPrefix)
+	assert.Equal(t, `<p:a xmlns:p="urn:p"><p:b/></p:a>`, w.String())
+}
+
+func TestEncodeDirective(t *testing.T) {
+	for expected, data := range map[string]string{
+		"<!DOCTYPE html>":                  "DOCTYPE html",
+		"<!DOCTYPE a [<!ENTITY e \"x\">]>": "<!DOCTYPE a [<!ENTITY e \"x\">]>",
+		"<!DOCTYPE a SYSTEM \"a.dtd\">":    "DOCTYPE a SYSTEM \"a.dtd\"",
+	} {
+		// given
+		w := &bytes.Buffer{}
+		enc := gosaxml.NewEncoder(w)
+
+		// when
+		err := enc.EncodeToken(&gosaxml.Token{Kind: gosaxml.TokenTypeDirective, ByteData: []byte(data)})
+		assert.Nil(t, enc.Flush())
+
+		// then
+		assert.Nil(t, err)
+		assert.Equal(t, expected, w.String())
+	}
+}
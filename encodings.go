@@ -0,0 +1,357 @@
+package gosaxml
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// character encodings detected by detectEncoding
+const (
+	encodingUTF8 = iota
+	encodingSingleByte
+	encodingUTF16BE
+	encodingUTF16LE
+	encodingUTF32BE
+	encodingUTF32LE
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF32BE = []byte{0x00, 0x00, 0xFE, 0xFF}
+	bomUTF32LE = []byte{0xFF, 0xFE, 0x00, 0x00}
+
+	bsXMLDeclStart = []byte("<?xml")
+	bsencoding     = []byte("encoding")
+
+	// names of the Unicode encodings, which are detected
+	// from the byte order mark or the leading '<'
+	unicodeEncodings = [][]byte{
+		[]byte("UTF-8"), []byte("UTF8"),
+		[]byte("UTF-16"), []byte("UTF-16BE"), []byte("UTF-16LE"),
+		[]byte("UTF-32"), []byte("UTF-32BE"), []byte("UTF-32LE"),
+	}
+)
+
+// detectEncoding determines the character encoding of a document from its
+// first (up to) four bytes as described in https://www.w3.org/TR/xml/#sec-guessing
+// and returns it together with the length of its byte order mark.
+// Without a byte order mark, the zero bytes of the leading '<' (of an XML
+// declaration or of the root element) tell UTF-16 and UTF-32 apart.
+func detectEncoding(b []byte) (encoding, bom int) {
+	switch {
+	case len(b) >= 2 && b[0] == '<' && b[1] != 0:
+		// the common case of UTF-8 (or single-byte) input without a byte order mark
+		return encodingUTF8, 0
+	case bytes.HasPrefix(b, bomUTF32BE):
+		return encodingUTF32BE, 4
+	case bytes.HasPrefix(b, bomUTF32LE):
+		return encodingUTF32LE, 4
+	case bytes.HasPrefix(b, bomUTF16BE):
+		return encodingUTF16BE, 2
+	case bytes.HasPrefix(b, bomUTF16LE):
+		return encodingUTF16LE, 2
+	case bytes.HasPrefix(b, bomUTF8):
+		return encodingUTF8, 3
+	case len(b) < 2:
+		return encodingUTF8, 0
+	case len(b) == 4 && b[0] == 0 && b[1] == 0 && b[2] == 0 && b[3] != 0:
+		return encodingUTF32BE, 0
+	case len(b) == 4 && b[0] != 0 && b[1] == 0 && b[2] == 0 && b[3] == 0:
+		return encodingUTF32LE, 0
+	case b[0] == 0 && b[1] != 0:
+		return encodingUTF16BE, 0
+	case b[0] != 0 && b[1] == 0:
+		return encodingUTF16LE, 0
+	}
+	return encodingUTF8, 0
+}
+
+// transcoder transcodes UTF-16, UTF-32 or single-byte encoded input into
+// UTF-8. Malformed input, like unpaired surrogates or bytes undefined in
+// the character set, is replaced with U+FFFD or, if strict, with the byte
+// 0xFF, which is invalid in UTF-8 and thus rejected by the character checks.
+type transcoder struct {
+	rd      io.Reader
+	err     error
+	order   binary.ByteOrder
+	charset *Charset
+	width   int
+	strict  bool
+	in      []byte
+	r       int
+	w       int
+	pending [utf8.UTFMax]byte
+	pr      int
+	pw      int
+}
+
+// reset makes the reader transcode the given already read bytes and then
+// everything read from rd in the given encoding, which is the given charset
+// for encodingSingleByte.
+func (thiz *transcoder) reset(rd io.Reader, encoding int, charset *Charset, prefix []byte, strict bool) {
+	thiz.rd = rd
+	thiz.strict = strict
+	thiz.err = nil
+	thiz.order = binary.BigEndian
+	if encoding == encodingUTF16LE || encoding == encodingUTF32LE {
+		thiz.order = binary.LittleEndian
+	}
+	thiz.charset = charset
+	switch encoding {
+	case encodingSingleByte:
+		thiz.width = 1
+	case encodingUTF32BE, encodingUTF32LE:
+		thiz.width = 4
+	default:
+		thiz.width = 2
+	}
+	if len(thiz.in) < max(len(prefix), 512) {
+		thiz.in = make([]byte, max(len(prefix), 512))
+	}
+	thiz.r = 0
+	thiz.w = copy(thiz.in, prefix)
+	thiz.pr = 0
+	thiz.pw = 0
+}
+
+func (thiz *transcoder) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if thiz.pr < thiz.pw {
+			// the rest of a character which did not fit into p before
+			c := copy(p[n:], thiz.pending[thiz.pr:thiz.pw])
+			thiz.pr += c
+			n += c
+			continue
+		}
+		if thiz.w-thiz.r < 4 && thiz.err == nil {
+			copy(thiz.in, thiz.in[thiz.r:thiz.w])
+			thiz.w -= thiz.r
+			thiz.r = 0
+			var m int
+			m, thiz.err = thiz.rd.Read(thiz.in[thiz.w:])
+			thiz.w += m
+			if m == 0 && n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		if thiz.r == thiz.w {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, thiz.err
+		}
+		if thiz.width == 1 && thiz.in[thiz.r] < utf8.RuneSelf {
+			// copy runs of ASCII characters as they are
+			k := thiz.r + 1
+			for k < thiz.w && k-thiz.r < len(p)-n && thiz.in[k] < utf8.RuneSelf {
+				k++
+			}
+			n += copy(p[n:], thiz.in[thiz.r:k])
+			thiz.r = k
+			continue
+		}
+		c, size := thiz.decodeRune(thiz.in[thiz.r:thiz.w])
+		thiz.r += size
+		if c < 0 {
+			if thiz.strict {
+				p[n] = 0xFF
+				n++
+				continue
+			}
+			c = utf8.RuneError
+		}
+		if len(p)-n >= utf8.UTFMax {
+			n += utf8.EncodeRune(p[n:], c)
+		} else {
+			thiz.pw = utf8.EncodeRune(thiz.pending[:], c)
+			thiz.pr = 0
+		}
+	}
+	return n, nil
+}
+
+// decodeRune decodes the first character in b, or returns -1 if it is
+// malformed. Less than four bytes are only passed at the end of the input.
+func (thiz *transcoder) decodeRune(b []byte) (rune, int) {
+	if len(b) < thiz.width {
+		return -1, len(b)
+	}
+	if thiz.width == 1 {
+		if b[0] < utf8.RuneSelf {
+			return rune(b[0]), 1
+		}
+		c := thiz.charset.decode[b[0]-0x80]
+		if c == utf8.RuneError {
+			// undefined in the character set
+			return -1, 1
+		}
+		return c, 1
+	}
+	if thiz.width == 4 {
+		c := rune(thiz.order.Uint32(b))
+		if !utf8.ValidRune(c) {
+			return -1, 4
+		}
+		return c, 4
+	}
+	c := rune(thiz.order.Uint16(b))
+	if !utf16.IsSurrogate(c) {
+		return c, 2
+	}
+	if len(b) >= 4 {
+		c = utf16.DecodeRune(c, rune(thiz.order.Uint16(b[2:])))
+		if c != utf8.RuneError {
+			return c, 4
+		}
+	}
+	return -1, 2
+}
+
+// isUnicodeEncoding reports whether name is the (case-insensitive)
+// name of UTF-8, UTF-16 or UTF-32.
+func isUnicodeEncoding(name []byte) bool {
+	for _, e := range unicodeEncodings {
+		if bytes.EqualFold(name, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSupportedEncoding reports whether the decoder can decode
+// input in the encoding with the given name.
+func isSupportedEncoding(name []byte) bool {
+	return isUnicodeEncoding(name) || findCharset(name) != nil
+}
+
+// declarationIncomplete reports whether b is the start
+// of an XML declaration without its closing "?>".
+func declarationIncomplete(b []byte) bool {
+	if len(b) >= 2 && b[1] != '?' {
+		return false
+	}
+	if len(b) < len(bsXMLDeclStart) {
+		return bytes.HasPrefix(bsXMLDeclStart, b)
+	}
+	return bytes.HasPrefix(b, bsXMLDeclStart) && bytes.Index(b, questAngleClose) < 0
+}
+
+// declaredEncoding returns the value of the encoding pseudo-attribute
+// of the XML declaration at the start of b, if any.
+func declaredEncoding(b []byte) []byte {
+	if len(b) <= len(bsXMLDeclStart) || b[1] != '?' || !bytes.HasPrefix(b, bsXMLDeclStart) || !isWhitespace(b[len(bsXMLDeclStart)]) {
+		return nil
+	}
+	end := bytes.Index(b, questAngleClose)
+	if end < 0 {
+		return nil
+	}
+	decl := b[len(bsXMLDeclStart):end]
+	i := bytes.Index(decl, bsencoding)
+	if i < 0 {
+		return nil
+	}
+	v := trimLeftSpace(decl[i+len(bsencoding):])
+	if len(v) == 0 || v[0] != '=' {
+		return nil
+	}
+	v = trimLeftSpace(v[1:])
+	if len(v) == 0 || v[0] != '"' && v[0] != '\'' {
+		return nil
+	}
+	j := bytes.IndexByte(v[1:], v[0])
+	if j < 0 {
+		return nil
+	}
+	return v[1 : j+1]
+}
+
+// singleByteCharset returns the character set of input detected as UTF-8
+// without a byte order mark which is given by WithCharset or declared by its
+// XML declaration at the start of b, or nil if it is UTF-8 (or ASCII).
+func (thiz *decoder) singleByteCharset(b []byte) *Charset {
+	if thiz.charset != nil {
+		return thiz.charset
+	}
+	charset := findCharset(declaredEncoding(b))
+	if charset != nil && charset.decode == &usASCII {
+		// ASCII is a subset of UTF-8
+		return nil
+	}
+	return charset
+}
+
+// readEncoding reads the first bytes of the input to detect its encoding.
+// The input is then transcoded to UTF-8 if needed and a byte order mark
+// is skipped.
+func (thiz *decoder) readEncoding() error {
+	thiz.sniff = false
+	var err error
+	for thiz.w < 4 && err == nil {
+		var n int
+		n, err = thiz.rd.Read(thiz.rb[thiz.w : len(thiz.rb)-simdWidth])
+		thiz.w += n
+	}
+	encoding, bom := detectEncoding(thiz.rb[:min(thiz.w, 4)])
+	var charset *Charset
+	if encoding == encodingUTF8 && bom == 0 {
+		for err == nil && thiz.charset == nil && declarationIncomplete(thiz.rb[:thiz.w]) && thiz.w < len(thiz.rb)-simdWidth {
+			var n int
+			n, err = thiz.rd.Read(thiz.rb[thiz.w : len(thiz.rb)-simdWidth])
+			thiz.w += n
+		}
+		charset = thiz.singleByteCharset(thiz.rb[:thiz.w])
+		if charset != nil {
+			encoding = encodingSingleByte
+		}
+	}
+	thiz.transcoded = encoding != encodingUTF8
+	if encoding == encodingUTF8 {
+		thiz.r = bom
+		thiz.docStart = bom
+		if thiz.w == 0 && err != nil {
+			return err
+		}
+		return nil
+	}
+	if thiz.transcoder == nil {
+		thiz.transcoder = &transcoder{}
+	}
+	thiz.transcoder.reset(thiz.rd, encoding, charset, thiz.rb[bom:thiz.w], thiz.checkCharacters)
+	thiz.transcoder.err = err
+	thiz.rd = thiz.transcoder
+	thiz.w = 0
+	return thiz.read0()
+}
+
+// transcode returns the UTF-8 encoding of the given input together with
+// the length of a UTF-8 byte order mark at its start. UTF-16, UTF-32 and
+// single-byte encoded input is transcoded into a copy without a byte order mark.
+func (thiz *decoder) transcode(in []byte) ([]byte, int) {
+	encoding, bom := detectEncoding(in[:min(len(in), 4)])
+	var charset *Charset
+	if encoding == encodingUTF8 && bom == 0 {
+		charset = thiz.singleByteCharset(in)
+		if charset != nil {
+			encoding = encodingSingleByte
+		}
+	}
+	thiz.transcoded = encoding != encodingUTF8
+	if encoding == encodingUTF8 {
+		return in, bom
+	}
+	if thiz.transcoder == nil {
+		thiz.transcoder = &transcoder{}
+	}
+	thiz.transcoder.reset(bytes.NewReader(in[bom:]), encoding, charset, nil, thiz.checkCharacters)
+	// reading from a bytes.Reader cannot fail
+	out, _ := io.ReadAll(thiz.transcoder)
+	return out, 0
+}
@@ -0,0 +1,142 @@
+package gosaxml_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/HBTGmbH/gosaxml"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"testing/iotest"
+	"unicode/utf16"
+)
+
+const encodingsDoc = `<?xml version="1.0"?><a b="äé">Grüße, 世界 😀</a>`
+
+var encodingsTokens = []string{
+	`3 xml version="1.0"`,
+	`1 a  b=äé`,
+	`5  Grüße, 世界 😀`,
+	`2 a `,
+}
+
+func encodeUTF16(s string, order binary.AppendByteOrder) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = order.AppendUint16(b, u)
+	}
+	return b
+}
+
+func encodeUTF32(s string, order binary.AppendByteOrder) []byte {
+	var b []byte
+	for _, r := range s {
+		b = order.AppendUint32(b, uint32(r))
+	}
+	return b
+}
+
+func TestDecodeEncodings(t *testing.T) {
+	for name, in := range map[string][]byte{
+		"UTF-8":                {},
+		"UTF-8 with BOM":       []byte("\uFEFF" + encodingsDoc),
+		"UTF-16BE with BOM":    encodeUTF16("\uFEFF"+encodingsDoc, binary.BigEndian),
+		"UTF-16LE with BOM":    encodeUTF16("\uFEFF"+encodingsDoc, binary.LittleEndian),
+		"UTF-16BE without BOM": encodeUTF16(encodingsDoc, binary.BigEndian),
+		"UTF-16LE without BOM": encodeUTF16(encodingsDoc, binary.LittleEndian),
+		"UTF-32BE with BOM":    encodeUTF32("\uFEFF"+encodingsDoc, binary.BigEndian),
+		"UTF-32LE with BOM":    encodeUTF32("\uFEFF"+encodingsDoc, binary.LittleEndian),
+		"UTF-32BE without BOM": encodeUTF32(encodingsDoc, binary.BigEndian),
+		"UTF-32LE without BOM": encodeUTF32(encodingsDoc, binary.LittleEndian),
+	} {
+		if len(in) == 0 {
+			in = []byte(encodingsDoc)
+		}
+
+		// when
+		tokens, err := decodeAllTokens(gosaxml.NewDecoder(bytes.NewReader(in), gosaxml.WithStrict()))
+		oneByteTokens, oneByteErr := decodeAllTokens(gosaxml.NewDecoder(iotest.OneByteReader(bytes.NewReader(in)), gosaxml.WithReadBufferSize(0)))
+		bytesTokens, bytesErr := decodeAllTokens(gosaxml.NewBytesDecoder(in, gosaxml.WithStrict()))
+
+		// then
+		t.Run(name, func(t *testing.T) {
+			assert.Nil(t, err)
+			assert.Nil(t, oneByteErr)
+			assert.Nil(t, bytesErr)
+			assert.Equal(t, encodingsTokens, tokens)
+			assert.Equal(t, encodingsTokens, oneByteTokens)
+			assert.Equal(t, encodingsTokens, bytesTokens)
+		})
+	}
+}
+
+func TestDecodeUTF16LongDocument(t *testing.T) {
+	// given
+	text := string(bytes.Repeat([]byte("äöü😀"), 1000))
+	in := encodeUTF16("\uFEFF<a>"+text+"</a>", binary.LittleEndian)
+	dec := gosaxml.NewDecoder(bytes.NewReader(in))
+
+	// when
+	tokens, err := decodeAllTokens(dec)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1 a ", "5  " + text, "2 a "}, tokens)
+}
+
+func TestDecodeUTF16Malformed(t *testing.T) {
+	// given
+	in := append(encodeUTF16("<a>", binary.BigEndian), 0xD8, 0x00)
+	in = append(in, encodeUTF16("x</a>", binary.BigEndian)...)
+	in = append(in, 0x00)
+
+	// when
+	tokens, err := decodeAllTokens(gosaxml.NewDecoder(bytes.NewReader(in), gosaxml.WithLossless()))
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1 a ", "5  �x", "2 a ", "5  �"}, tokens)
+}
+
+func TestDecodeUTF16MalformedWithCharacterChecks(t *testing.T) {
+	// given
+	in := append(encodeUTF16("<a>x", binary.BigEndian), 0xD8, 0x00)
+	in = append(in, encodeUTF16("</a>", binary.BigEndian)...)
+
+	// when
+	_, err := decodeAllTokens(gosaxml.NewDecoder(bytes.NewReader(in), gosaxml.WithCharacterChecks()))
+	_, bytesErr := decodeAllTokens(gosaxml.NewBytesDecoder(in, gosaxml.WithCharacterChecks()))
+
+	// then
+	assert.ErrorIs(t, err, gosaxml.ErrInvalidCharacter)
+	assert.ErrorIs(t, bytesErr, gosaxml.ErrInvalidCharacter)
+}
+
+func TestDecodeUTF8BOMOffsets(t *testing.T) {
+	// given
+	dec := gosaxml.NewDecoder(bytes.NewReader([]byte("\uFEFF<a/>")))
+	var tk gosaxml.Token
+
+	// when
+	err := dec.NextToken(&tk)
+	start, end := dec.TokenOffsets()
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, 3, start)
+	assert.Equal(t, 7, end)
+}
+
+func TestDecodeResetEncoding(t *testing.T) {
+	// given
+	dec := gosaxml.NewDecoder(bytes.NewReader(encodeUTF16("\uFEFF<a/>", binary.LittleEndian)))
+	_, err1 := decodeAllTokens(dec)
+
+	// when
+	dec.Reset(bytes.NewReader([]byte("<b/>")))
+	tokens, err2 := decodeAllTokens(dec)
+
+	// then
+	assert.Nil(t, err1)
+	assert.Nil(t, err2)
+	assert.Equal(t, []string{"1 b ", "2 b "}, tokens)
+}
@@ -0,0 +1,189 @@
+package gosaxml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+var (
+	bslt   = []byte("lt")
+	bsgt   = []byte("gt")
+	bsamp  = []byte("amp")
+	bsapos = []byte("apos")
+	bsquot = []byte("quot")
+
+	escAmp  = []byte("&amp;")
+	escLt   = []byte("&lt;")
+	escGt   = []byte("&gt;")
+	escApos = []byte("&apos;")
+	escQuot = []byte("&quot;")
+	escTab  = []byte("&#x9;")
+	escNL   = []byte("&#xA;")
+	escCR   = []byte("&#xD;")
+)
+
+// unescape resolves the predefined entity references (like "&amp;") and
+// the decimal and hexadecimal character references (like "&#x20AC;") in v.
+// Because every reference is at least as long as its UTF-8 encoding,
+// v is decoded in place and the returned slice is a prefix of v.
+func unescape(v []byte) ([]byte, error) {
+	k := bytes.IndexByte(v, '&')
+	if k < 0 {
+		return v, nil
+	}
+	w := k
+	for r := k; r < len(v); {
+		c := v[r]
+		if c != '&' {
+			v[w] = c
+			w++
+			r++
+			continue
+		}
+		end := bytes.IndexByte(v[r+1:], ';')
+		if end < 0 {
+			return nil, errors.New("invalid XML: unterminated entity reference")
+		}
+		ref := v[r+1 : r+1+end]
+		r += end + 2
+		if len(ref) > 0 && ref[0] == '#' {
+			cp, err := parseCharRef(ref[1:])
+			if err != nil {
+				return nil, err
+			}
+			w += utf8.EncodeRune(v[w:], cp)
+			continue
+		}
+		switch {
+		case bytes.Equal(ref, bslt):
+			v[w] = '<'
+		case bytes.Equal(ref, bsgt):
+			v[w] = '>'
+		case bytes.Equal(ref, bsamp):
+			v[w] = '&'
+		case bytes.Equal(ref, bsapos):
+			v[w] = '\''
+		case bytes.Equal(ref, bsquot):
+			v[w] = '"'
+		default:
+			return nil, fmt.Errorf("invalid XML: undefined entity reference &%s;", ref)
+		}
+		w++
+	}
+	return v[:w], nil
+}
+
+// parseCharRef parses the digits of a character reference (without the
+// leading "&#" and trailing ';'), which are hexadecimal if prefixed with 'x'.
+func parseCharRef(ref []byte) (rune, error) {
+	base := rune(10)
+	digits := ref
+	if len(ref) > 0 && ref[0] == 'x' {
+		base = 16
+		digits = ref[1:]
+	}
+	if len(digits) == 0 {
+		return 0, errors.New("invalid XML: empty character reference")
+	}
+	var cp rune
+	for _, c := range digits {
+		var d rune
+		switch {
+		case c >= '0' && c <= '9':
+			d = rune(c - '0')
+		case base == 16 && c >= 'a' && c <= 'f':
+			d = rune(c-'a') + 10
+		case base == 16 && c >= 'A' && c <= 'F':
+			d = rune(c-'A') + 10
+		default:
+			return 0, fmt.Errorf("invalid XML: malformed character reference &#%s;", ref)
+		}
+		cp = cp*base + d
+		if cp > utf8.MaxRune {
+			return 0, fmt.Errorf("invalid XML: character reference &#%s; out of range", ref)
+		}
+	}
+	if !isXMLChar(cp) {
+		return 0, fmt.Errorf("invalid XML: character reference &#%s; is not a legal character", ref)
+	}
+	return cp, nil
+}
+
+// isXMLChar reports whether the given rune matches the Char production
+// of https://www.w3.org/TR/xml/#NT-Char
+func isXMLChar(r rune) bool {
+	return r == 0x09 || r == 0x0A || r == 0x0D ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= utf8.MaxRune
+}
+
+// AppendEscapedText appends src to dst with the characters '&', '<' and '>'
+// replaced by entity references and '\r' replaced by a character reference,
+// so that the result can be written as the content of an element.
+// It returns the extended buffer and does not allocate if dst has enough capacity.
+func AppendEscapedText(dst, src []byte) []byte {
+	last := 0
+	for i, c := range src {
+		var esc []byte
+		switch c {
+		case '&':
+			esc = escAmp
+		case '<':
+			esc = escLt
+		case '>':
+			esc = escGt
+		case '\r':
+			esc = escCR
+		default:
+			continue
+		}
+		dst = append(dst, src[last:i]...)
+		dst = append(dst, esc...)
+		last = i + 1
+	}
+	return append(dst, src[last:]...)
+}
+
+// AppendEscapedAttr appends src to dst with the characters '&' and '<'
+// and the quote character delimiting the attribute value (a single quote
+// if singleQuote is true, otherwise a double quote) replaced by entity
+// references. Tabs and line breaks are replaced by character references,
+// because a parser would otherwise normalize them to spaces.
+// It returns the extended buffer and does not allocate if dst has enough capacity.
+func AppendEscapedAttr(dst, src []byte, singleQuote bool) []byte {
+	last := 0
+	for i, c := range src {
+		var esc []byte
+		switch c {
+		case '&':
+			esc = escAmp
+		case '<':
+			esc = escLt
+		case '\'':
+			if !singleQuote {
+				continue
+			}
+			esc = escApos
+		case '"':
+			if singleQuote {
+				continue
+			}
+			esc = escQuot
+		case '\t':
+			esc = escTab
+		case '\n':
+			esc = escNL
+		case '\r':
+			esc = escCR
+		default:
+			continue
+		}
+		dst = append(dst, src[last:i]...)
+		dst = append(dst, esc...)
+		last = i + 1
+	}
+	return append(dst, src[last:]...)
+}
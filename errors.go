@@ -0,0 +1,154 @@
+package gosaxml
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Categories of a SyntaxError. Use errors.Is to check whether an error
+// returned by a Decoder belongs to one of these categories.
+var (
+	// ErrInvalidMarkup is the category of malformed comments, CDATA sections,
+	// DOCTYPE declarations and other markup.
+	ErrInvalidMarkup = errors.New("invalid markup")
+
+	// ErrInvalidAttribute is the category of malformed attributes.
+	ErrInvalidAttribute = errors.New("invalid attribute")
+
+	// ErrInvalidReference is the category of malformed or undefined
+	// entity and character references.
+	ErrInvalidReference = errors.New("invalid reference")
+
+	// ErrUnexpectedEndElement is the category of end elements
+	// without a matching start element.
+	ErrUnexpectedEndElement = errors.New("unexpected end element")
+
+	// ErrNestingTooDeep is the category of elements nested
+	// deeper than the configured maximum depth.
+	ErrNestingTooDeep = errors.New("nesting too deep")
+
+	// ErrUndeclaredPrefix is the category of names
+	// with a namespace prefix that is not declared.
+	ErrUndeclaredPrefix = errors.New("undeclared namespace prefix")
+
+	// ErrReservedNamespace is the category of declarations which rebind the
+	// reserved prefixes xml and xmlns or their namespaces, and of elements
+	// with the prefix xmlns.
+	ErrReservedNamespace = errors.New("reserved namespace")
+
+	// ErrEmptyNamespace is the category of declarations
+	// which bind a prefix to the empty namespace.
+	ErrEmptyNamespace = errors.New("empty namespace")
+
+	// ErrDuplicateAttribute is the category of elements with
+	// two attributes of the same name (and namespace).
+	ErrDuplicateAttribute = errors.New("duplicate attribute")
+
+	// ErrInvalidName is the category of element, attribute and
+	// processing instruction names which do not match the Name production.
+	ErrInvalidName = errors.New("invalid name")
+
+	// ErrInvalidCharacter is the category of characters which do not match
+	// the Char production and of byte sequences which are not valid UTF-8.
+	ErrInvalidCharacter = errors.New("invalid character")
+
+	// ErrInvalidDeclaration is the category of malformed XML declarations
+	// and of declarations of an encoding which is not supported.
+	ErrInvalidDeclaration = errors.New("invalid XML declaration")
+
+	// ErrMismatchedEndElement is the category of end elements
+	// whose name differs from the name of the open element.
+	ErrMismatchedEndElement = errors.New("mismatched end element")
+
+	// ErrMisplacedContent is the category of content which is not allowed
+	// outside of the root element, like text or a second root element.
+	ErrMisplacedContent = errors.New("misplaced content")
+
+	// ErrUnexpectedEOF is the category of inputs which end
+	// before the document is complete.
+	ErrUnexpectedEOF = errors.New("unexpected EOF")
+)
+
+// ErrNotAtStartElement is returned by Decoder.WriteOuterXML when it is not
+// called directly after NextToken returned a start element.
+var ErrNotAtStartElement = errors.New("decoder is not positioned on a start element")
+
+// SyntaxError is returned by a Decoder for malformed XML input.
+// Errors of the underlying io.Reader (like io.EOF) are returned unchanged.
+type SyntaxError struct {
+	// Err is the category of the error, like ErrInvalidAttribute.
+	Err error
+
+	// Msg describes the error.
+	Msg string
+
+	// Offset is the input offset (see Decoder.InputOffset)
+	// at which the error was detected.
+	Offset int
+
+	// Line and Column are the 1-based line and column (in bytes)
+	// at which the error was detected. They are only known if the
+	// Decoder was created with WithPositionTracking and zero otherwise.
+	Line   int
+	Column int
+
+	// Path is the slash-separated path of the elements that were
+	// open when the error was detected, like "/soap:Envelope/soap:Body".
+	Path string
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s (offset %d, path %s)", e.Msg, e.Offset, e.Path)
+	}
+	return fmt.Sprintf("%s (line %d, column %d, offset %d, path %s)", e.Msg, e.Line, e.Column, e.Offset, e.Path)
+}
+
+// Unwrap returns the category of the error.
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// syntaxError creates a SyntaxError of the given category
+// at the current position of the decoder.
+func (thiz *decoder) syntaxError(category error, msg string) error {
+	offset := thiz.InputOffset()
+	err := &SyntaxError{
+		Err:    category,
+		Msg:    msg,
+		Offset: offset,
+		Path:   thiz.path(),
+	}
+	if thiz.trackPositions {
+		thiz.countLines(thiz.r)
+		err.Line = thiz.line + 1
+		err.Column = offset - thiz.lineStart + 1
+	}
+	return err
+}
+
+// path builds the slash-separated path of all open elements.
+func (thiz *decoder) path() string {
+	if thiz.top == 0 {
+		return "/"
+	}
+	var b []byte
+	for i := 1; i <= thiz.top; i++ {
+		name := thiz.names[i]
+		if len(name.Local) == 0 {
+			// the name of the innermost element could not be read
+			break
+		}
+		b = append(b, '/')
+		if len(name.Prefix) > 0 {
+			b = append(b, name.Prefix...)
+			b = append(b, ':')
+		}
+		b = append(b, name.Local...)
+	}
+	if len(b) == 0 {
+		// the name of the root element could not be read
+		return "/"
+	}
+	return string(b)
+}
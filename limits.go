@@ -0,0 +1,126 @@
+package gosaxml
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Limits restricts the resources a Decoder spends on its input in order to
+// protect against hostile documents. A limit of zero means unlimited.
+// Lengths are measured in bytes of the (raw) input.
+type Limits struct {
+	// MaxNameLength limits the length of element, attribute and
+	// processing instruction names, including their prefix.
+	MaxNameLength int
+
+	// MaxAttributes limits the number of attributes of an element.
+	MaxAttributes int
+
+	// MaxAttributeValueLength limits the length of attribute values.
+	MaxAttributeValueLength int
+
+	// MaxTextLength limits the length of texts, CDATA sections, comments,
+	// processing instructions and directives.
+	MaxTextLength int
+
+	// MaxInputSize limits the total number of bytes read from the input.
+	MaxInputSize int
+
+	// MaxTokens limits the total number of decoded tokens.
+	MaxTokens int
+}
+
+// Categories of a LimitError. Use errors.Is to check which limit
+// was exceeded.
+var (
+	ErrNameTooLong           = errors.New("name too long")
+	ErrTooManyAttributes     = errors.New("too many attributes")
+	ErrAttributeValueTooLong = errors.New("attribute value too long")
+	ErrTextTooLong           = errors.New("text too long")
+	ErrInputTooLarge         = errors.New("input too large")
+	ErrTooManyTokens         = errors.New("too many tokens")
+)
+
+// LimitError is returned by a Decoder when its input exceeds one of its Limits.
+type LimitError struct {
+	// Err is the category of the error, like ErrNameTooLong.
+	Err error
+
+	// Limit is the value of the exceeded limit.
+	Limit int
+
+	// Offset is the input offset (see Decoder.InputOffset)
+	// at which the limit was exceeded.
+	Offset int
+
+	// Path is the slash-separated path of the elements that were
+	// open when the limit was exceeded, or "/" if there were none.
+	Path string
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: exceeds limit of %d (offset %d, path %s)", e.Err, e.Limit, e.Offset, e.Path)
+}
+
+// Unwrap returns the category of the error.
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// limitError creates a LimitError of the given category
+// at the current position of the decoder.
+func (thiz *decoder) limitError(category error, limit int) error {
+	return &LimitError{
+		Err:    category,
+		Limit:  limit,
+		Offset: thiz.InputOffset(),
+		Path:   thiz.path(),
+	}
+}
+
+// beginValue starts limiting the length of the value read from the
+// current position on, so that a value exceeding the limit is detected
+// by read0 before it is buffered completely.
+func (thiz *decoder) beginValue(limit int, category error) {
+	thiz.valueStart = thiz.off + thiz.r
+	thiz.valueLimit = limit
+	thiz.valueErr = category
+}
+
+// endValue stops limiting the length of the current value
+// and checks its final length n.
+func (thiz *decoder) endValue(n int) error {
+	limit := thiz.valueLimit
+	thiz.valueLimit = 0
+	if limit > 0 && n > limit {
+		return thiz.limitError(thiz.valueErr, limit)
+	}
+	return nil
+}
+
+// checkValueLimit is called by read0 before reading more input.
+func (thiz *decoder) checkValueLimit() error {
+	if thiz.valueLimit > 0 && thiz.off+thiz.r-thiz.valueStart > thiz.valueLimit {
+		return thiz.limitError(thiz.valueErr, thiz.valueLimit)
+	}
+	return nil
+}
+
+// checkTokenLimits checks the limits on the given decoded token
+// and on the total input and number of tokens.
+func (thiz *decoder) checkTokenLimits(t *Token) error {
+	thiz.tokens++
+	if thiz.limits.MaxTokens > 0 && thiz.tokens > thiz.limits.MaxTokens {
+		return thiz.limitError(ErrTooManyTokens, thiz.limits.MaxTokens)
+	}
+	if thiz.limits.MaxInputSize > 0 && thiz.InputOffset() > thiz.limits.MaxInputSize {
+		return thiz.limitError(ErrInputTooLarge, thiz.limits.MaxInputSize)
+	}
+	switch t.Kind {
+	case TokenTypeTextElement, TokenTypeCharData, TokenTypeComment, TokenTypeProcInst, TokenTypeDirective:
+		if thiz.limits.MaxTextLength > 0 && len(t.ByteData) > thiz.limits.MaxTextLength {
+			return thiz.limitError(ErrTextTooLong, thiz.limits.MaxTextLength)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package gosaxml_test
+
+import (
+	"errors"
+	"github.com/HBTGmbH/gosaxml"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func decodeWithLimits(doc string, limits gosaxml.Limits, opts ...gosaxml.DecoderOption) error {
+	_, err := decodeTokens(doc, append(opts, gosaxml.WithLimits(limits))...)
+	return err
+}
+
+func assertLimitError(t *testing.T, err error, category error, limit int) {
+	t.Helper()
+	var limitErr *gosaxml.LimitError
+	assert.True(t, errors.As(err, &limitErr), "expected a LimitError but got %v", err)
+	assert.ErrorIs(t, err, category)
+	assert.Equal(t, limit, limitErr.Limit)
+}
+
+func TestLimitsNotExceeded(t *testing.T) {
+	// given
+	doc := `<?pi 123?><abc d="1" e:f="234"><!--12345-->12345<![CDATA[12345]]></abc>`
+	limits := gosaxml.Limits{
+		MaxNameLength:           5,
+		MaxAttributes:           2,
+		MaxAttributeValueLength: 3,
+		MaxTextLength:           5,
+		MaxInputSize:            len(doc),
+		MaxTokens:               7,
+	}
+
+	// when
+	err := decodeWithLimits(doc, limits, gosaxml.WithComments())
+
+	// then
+	assert.Nil(t, err)
+}
+
+func TestLimitsExceeded(t *testing.T) {
+	long := strings.Repeat("x", 5000)
+	for name, tc := range map[string]struct {
+		doc      string
+		limits   gosaxml.Limits
+		category error
+		limit    int
+	}{
+		"element name":           {`<abcdef/>`, gosaxml.Limits{MaxNameLength: 5}, gosaxml.ErrNameTooLong, 5},
+		"prefixed name":          {`<ab:cd/>`, gosaxml.Limits{MaxNameLength: 4}, gosaxml.ErrNameTooLong, 4},
+		"long element name":      {`<` + long + `/>`, gosaxml.Limits{MaxNameLength: 5}, gosaxml.ErrNameTooLong, 5},
+		"attribute name":         {`<a bcdefg="1"/>`, gosaxml.Limits{MaxNameLength: 5}, gosaxml.ErrNameTooLong, 5},
+		"attributes":             {`<a b="1" c="2" d="3"/>`, gosaxml.Limits{MaxAttributes: 2}, gosaxml.ErrTooManyAttributes, 2},
+		"attribute value":        {`<a b="1234"/>`, gosaxml.Limits{MaxAttributeValueLength: 3}, gosaxml.ErrAttributeValueTooLong, 3},
+		"long attribute value":   {`<a b="` + long + `"/>`, gosaxml.Limits{MaxAttributeValueLength: 3}, gosaxml.ErrAttributeValueTooLong, 3},
+		"text":                   {`<a>123456</a>`, gosaxml.Limits{MaxTextLength: 5}, gosaxml.ErrTextTooLong, 5},
+		"long text":              {`<a>` + long + `</a>`, gosaxml.Limits{MaxTextLength: 5}, gosaxml.ErrTextTooLong, 5},
+		"CDATA":                  {`<a><![CDATA[` + long + `]]></a>`, gosaxml.Limits{MaxTextLength: 5}, gosaxml.ErrTextTooLong, 5},
+		"comment":                {`<a><!--` + long + `--></a>`, gosaxml.Limits{MaxTextLength: 5}, gosaxml.ErrTextTooLong, 5},
+		"processing instruction": {`<?pi ` + long + `?>`, gosaxml.Limits{MaxTextLength: 5}, gosaxml.ErrTextTooLong, 5},
+		"directive":              {`<!DOCTYPE ` + long + `>`, gosaxml.Limits{MaxTextLength: 5}, gosaxml.ErrTextTooLong, 5},
+		"input":                  {`<a>` + long + `</a>`, gosaxml.Limits{MaxInputSize: 100}, gosaxml.ErrInputTooLarge, 100},
+		"tokens":                 {`<a><b/><c/></a>`, gosaxml.Limits{MaxTokens: 4}, gosaxml.ErrTooManyTokens, 4},
+	} {
+		// when
+		err := decodeWithLimits(tc.doc, tc.limits, gosaxml.WithComments())
+		_, bytesErr := decodeAllTokens(gosaxml.NewBytesDecoder([]byte(tc.doc), gosaxml.WithComments(), gosaxml.WithLimits(tc.limits)))
+
+		// then
+		t.Run(name, func(t *testing.T) {
+			assertLimitError(t, err, tc.category, tc.limit)
+			assertLimitError(t, bytesErr, tc.category, tc.limit)
+		})
+	}
+}
+
+func TestLimitsIgnoredComment(t *testing.T) {
+	// given
+	doc := "<a>\n<!--" + strings.Repeat("x", 5000) + "-->\n</a>"
+
+	// when
+	err := decodeWithLimits(doc, gosaxml.Limits{MaxTextLength: 5})
+
+	// then
+	assert.Nil(t, err)
+}
+
+func TestLimitErrorMessage(t *testing.T) {
+	// when
+	err := decodeWithLimits(`<a><bcdefg/></a>`, gosaxml.Limits{MaxNameLength: 5})
+
+	// then
+	assert.EqualError(t, err, "name too long: exceeds limit of 5 (offset 11, path /a)")
+}
+
+func TestLimitsMeasureRawInput(t *testing.T) {
+	for name, tc := range map[string]struct {
+		doc      string
+		limits   gosaxml.Limits
+		category error
+	}{
+		"text":            {`<a>&amp;&amp;</a>`, gosaxml.Limits{MaxTextLength: 5}, gosaxml.ErrTextTooLong},
+		"attribute value": {`<a b="&amp;&amp;"/>`, gosaxml.Limits{MaxAttributeValueLength: 5}, gosaxml.ErrAttributeValueTooLong},
+	} {
+		// when
+		err := decodeWithLimits(tc.doc, tc.limits, gosaxml.WithEntityDecoding())
+		_, bytesErr := decodeAllTokens(gosaxml.NewBytesDecoder([]byte(tc.doc), gosaxml.WithEntityDecoding(), gosaxml.WithLimits(tc.limits)))
+
+		// then
+		t.Run(name, func(t *testing.T) {
+			assertLimitError(t, err, tc.category, 5)
+			assertLimitError(t, bytesErr, tc.category, 5)
+		})
+	}
+}
+
+func TestLimitErrorPathAtRootElement(t *testing.T) {
+	for doc, tc := range map[string]struct {
+		limits gosaxml.Limits
+		path   string
+	}{
+		`<a b="1" c="2"/>`: {gosaxml.Limits{MaxAttributes: 1}, "/a"},
+		`<a b="1234"/>`:    {gosaxml.Limits{MaxAttributeValueLength: 3}, "/a"},
+		`<a>1234</a>`:      {gosaxml.Limits{MaxTextLength: 3}, "/a"},
+		`<abcd/>`:          {gosaxml.Limits{MaxNameLength: 3}, "/"},
+	} {
+		// when
+		err := decodeWithLimits(doc, tc.limits)
+
+		// then
+		var limitErr *gosaxml.LimitError
+		assert.True(t, errors.As(err, &limitErr), doc)
+		assert.Equal(t, tc.path, limitErr.Path, doc)
+	}
+}
@@ -3,15 +3,16 @@ package gosaxml
 import (
 	"bytes"
 	"errors"
+	"fmt"
 )
 
 // NamespaceModifier can be used to obtain information about the
 // effective namespace of a decoded Token via NamespaceOfToken
 // and to canonicalize/minify namespace declarations.
 type NamespaceModifier struct {
-	openNames         [256]Name
-	nsOffs            [256]int32
-	prefixAliasesOffs [256]int32
+	openNames         []Name
+	nsOffs            []int32
+	prefixAliasesOffs []int32
 
 	namespaces    [][]byte
 	prefixAliases [][]byte
@@ -19,9 +20,23 @@ type NamespaceModifier struct {
 	// backing storage for generated multi-character prefix aliases
 	aliasBuf []byte
 
-	top byte
+	top int
+
+	// reusable storage for checking namespaces
+	checker namespaceChecker
 
 	PreserveOriginalPrefixes bool
+
+	// MaxDepth is the maximum element nesting depth, beyond which
+	// EncodeToken fails with an error. Zero (or a negative value)
+	// means DefaultMaxDepth.
+	MaxDepth int
+
+	// CheckNamespaces makes EncodeToken check that start elements are
+	// namespace-well-formed and fail with an error of the categories
+	// ErrUndeclaredPrefix, ErrReservedNamespace, ErrEmptyNamespace or
+	// ErrDuplicateAttribute otherwise.
+	CheckNamespaces bool
 }
 
 var (
@@ -31,8 +46,11 @@ var (
 // NewNamespaceModifier creates a new NamespaceModifier and returns a pointer to it.
 func NewNamespaceModifier() *NamespaceModifier {
 	return &NamespaceModifier{
-		namespaces:    make([][]byte, 0, 64),
-		prefixAliases: make([][]byte, 0, 64),
+		openNames:         make([]Name, 256),
+		nsOffs:            make([]int32, 256),
+		prefixAliasesOffs: make([]int32, 256),
+		namespaces:        make([][]byte, 0, 64),
+		prefixAliases:     make([][]byte, 0, 64),
 	}
 }
 
@@ -56,12 +74,23 @@ func (thiz *NamespaceModifier) Reset() {
 func (thiz *NamespaceModifier) EncodeToken(t *Token) error {
 	switch t.Kind {
 	case TokenTypeStartElement:
+		// check before entering the scope of the element,
+		// so that a rejected element leaves no frame behind
+		if thiz.CheckNamespaces {
+			msg, category := thiz.checker.checkNamespaces(t, thiz)
+			if category != nil {
+				return fmt.Errorf("%w: %s", category, msg)
+			}
+		}
 		err := thiz.pushFrame()
 		if err != nil {
 			return err
 		}
 		err = thiz.processNamespaces(t)
 		if err != nil {
+			// drop the bindings of the rejected element; popping
+			// the frame pushed above cannot fail
+			_ = thiz.popFrame()
 			return err
 		}
 		thiz.processElementName(t)
@@ -118,6 +147,16 @@ func (thiz *NamespaceModifier) findNamespaceForPrefix(prefix []byte) []byte {
 	return nil
 }
 
+// lookupNamespace finds the namespace bound to the given original
+// (not rewritten) prefix in the scope of the current element.
+func (thiz *NamespaceModifier) lookupNamespace(prefix []byte) []byte {
+	alias := thiz.findPrefixAlias(prefix)
+	if len(alias) > 0 {
+		prefix = alias
+	}
+	return thiz.findNamespaceForPrefix(prefix)
+}
+
 // findPrefixForNamespace finds the prefix which binds the given namespace (if any)
 // This is the reverse operation of findNamespaceForPrefix.
 func (thiz *NamespaceModifier) findPrefixForNamespace(namespace []byte) []byte {
@@ -144,10 +183,19 @@ func (thiz *NamespaceModifier) findPrefixAlias(prefix []byte) []byte {
 }
 
 func (thiz *NamespaceModifier) pushFrame() error {
-	if thiz.top == 255 {
-		return errors.New("stack overflow")
+	maxDepth := thiz.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+	if thiz.top >= maxDepth {
+		return fmt.Errorf("element nesting depth exceeds %d", maxDepth)
 	}
 	thiz.top++
+	for thiz.top >= len(thiz.nsOffs) {
+		thiz.openNames = append(thiz.openNames, Name{})
+		thiz.nsOffs = append(thiz.nsOffs, 0)
+		thiz.prefixAliasesOffs = append(thiz.prefixAliasesOffs, 0)
+	}
 	thiz.nsOffs[thiz.top] = thiz.nsOffs[thiz.top-1]
 	thiz.prefixAliasesOffs[thiz.top] = thiz.prefixAliasesOffs[thiz.top-1]
 	return nil
@@ -0,0 +1,331 @@
+package gosaxml
+
+import (
+	"bytes"
+	"fmt"
+	"hash/maphash"
+)
+
+var (
+	// the namespaces bound to the reserved prefixes "xml" and "xmlns"
+	// (https://www.w3.org/TR/xml-names/#ns-decl)
+	bsxmlNamespace   = []byte("http://www.w3.org/XML/1998/namespace")
+	bsxmlnsNamespace = []byte("http://www.w3.org/2000/xmlns/")
+)
+
+// bindNamespaces adds the namespace declarations among the given attributes
+// of a start element to the current stack frame and resolves the namespaces
+// of the element name and of all attribute names.
+func (thiz *decoder) bindNamespaces(name *Name, attrs []Attr) {
+	for i := 0; i < len(attrs); i++ {
+		attr := &attrs[i]
+		if bytes.Equal(attr.Name.Prefix, bsxmlns) { // <- xmlns:prefix
+			thiz.bindNamespace(attr.Name.Local, attr.Value)
+		} else if attr.Name.Prefix == nil && bytes.Equal(attr.Name.Local, bsxmlns) { // <- xmlns
+			thiz.bindNamespace(nil, attr.Value)
+		}
+	}
+	name.Namespace = thiz.lookupNamespace(name.Prefix)
+	for i := 0; i < len(attrs); i++ {
+		attr := &attrs[i]
+		switch {
+		case bytes.Equal(attr.Name.Prefix, bsxmlns):
+			attr.Name.Namespace = bsxmlnsNamespace
+		case len(attr.Name.Prefix) > 0:
+			attr.Name.Namespace = thiz.lookupNamespace(attr.Name.Prefix)
+		case bytes.Equal(attr.Name.Local, bsxmlns):
+			attr.Name.Namespace = bsxmlnsNamespace
+		default:
+			// Unprefixed attributes are never in the default namespace
+			// (https://www.w3.org/TR/xml-names/#defaulting).
+			attr.Name.Namespace = nil
+		}
+	}
+}
+
+// bindNamespace adds the binding of the given prefix
+// to the given namespace to the current stack frame.
+func (thiz *decoder) bindNamespace(prefix, namespace []byte) {
+	thiz.nsBindings = append(thiz.nsBindings, prefix, namespace)
+	if thiz.prefixes.active {
+		thiz.prefixes.push(thiz.nsBindings)
+	} else if len(thiz.nsBindings) > 2*maxScannedBindings {
+		thiz.prefixes.build(thiz.nsBindings)
+	}
+}
+
+// unbindNamespaces removes the bindings of the current stack frame.
+func (thiz *decoder) unbindNamespaces() {
+	off := thiz.nsOffs[thiz.top]
+	if thiz.prefixes.active {
+		thiz.prefixes.pop(thiz.nsBindings, int(off))
+	}
+	thiz.nsBindings = thiz.nsBindings[:off]
+}
+
+// lookupNamespace returns the namespace bound to the given prefix
+// (or the default namespace for an empty prefix) in the current scope,
+// or nil if there is none.
+func (thiz *decoder) lookupNamespace(prefix []byte) []byte {
+	if bytes.Equal(prefix, bsxml) {
+		return bsxmlNamespace
+	}
+	i := len(thiz.nsBindings) - 2
+	if thiz.prefixes.active {
+		i = thiz.prefixes.lookup(thiz.nsBindings, prefix)
+	} else {
+		for i >= 0 && !bytes.Equal(thiz.nsBindings[i], prefix) {
+			i -= 2
+		}
+	}
+	if i < 0 || len(thiz.nsBindings[i+1]) == 0 {
+		// not declared or undeclared via xmlns=""
+		return nil
+	}
+	return thiz.nsBindings[i+1]
+}
+
+// maxScannedBindings is the number of namespace bindings in scope up to
+// which prefixes are looked up by scanning all of them, which is faster
+// than hashing for the few namespaces of most documents.
+const maxScannedBindings = 16
+
+// prefixIndex maps every prefix bound in the namespace bindings of a
+// decoder to its innermost binding, so that prefixes are looked up in
+// constant time even if many namespaces are in scope. The bindings are
+// pairs of prefix and namespace, which are numbered in the order they
+// have been added.
+type prefixIndex struct {
+	// 1 + the number of a binding, or 0 for a free slot
+	slots []int32
+	// the slot value (possibly 0) of the binding of the same
+	// prefix which is shadowed by a binding, by binding number
+	shadowed []int32
+	active   bool
+}
+
+// build indexes all given bindings and activates the index.
+func (thiz *prefixIndex) build(bindings [][]byte) {
+	n := len(bindings) / 2
+	size := 64
+	for size < 4*n {
+		size *= 2
+	}
+	if cap(thiz.slots) < size {
+		thiz.slots = make([]int32, size)
+	} else {
+		thiz.slots = thiz.slots[:size]
+		clear(thiz.slots)
+	}
+	thiz.shadowed = thiz.shadowed[:0]
+	thiz.active = true
+	for b := 0; b < n; b++ {
+		thiz.insert(bindings, b)
+	}
+}
+
+// push indexes the last of the given bindings.
+func (thiz *prefixIndex) push(bindings [][]byte) {
+	if len(bindings) > len(thiz.slots) {
+		// keep the load factor at most 1/2
+		thiz.build(bindings)
+		return
+	}
+	thiz.insert(bindings, len(bindings)/2-1)
+}
+
+func (thiz *prefixIndex) insert(bindings [][]byte, b int) {
+	s := thiz.slot(bindings, bindings[2*b])
+	thiz.shadowed = append(thiz.shadowed, thiz.slots[s])
+	thiz.slots[s] = int32(b + 1)
+}
+
+// pop removes the bindings from the given offset into bindings on
+// from the index, or deactivates it if only a few bindings remain.
+func (thiz *prefixIndex) pop(bindings [][]byte, off int) {
+	if off <= 2*maxScannedBindings {
+		thiz.active = false
+		return
+	}
+	for b := len(bindings)/2 - 1; b >= off/2; b-- {
+		s := thiz.slot(bindings, bindings[2*b])
+		if shadowed := thiz.shadowed[b]; shadowed > 0 {
+			thiz.slots[s] = shadowed
+		} else {
+			thiz.remove(bindings, s)
+		}
+	}
+	thiz.shadowed = thiz.shadowed[:off/2]
+}
+
+// lookup returns the offset into bindings of the innermost
+// binding of the given prefix, or -1 if there is none.
+func (thiz *prefixIndex) lookup(bindings [][]byte, prefix []byte) int {
+	if e := thiz.slots[thiz.slot(bindings, prefix)]; e > 0 {
+		return 2 * int(e-1)
+	}
+	return -1
+}
+
+// slot returns the index of the slot holding the given prefix
+// or of the free slot it belongs into.
+func (thiz *prefixIndex) slot(bindings [][]byte, prefix []byte) int {
+	mask := len(thiz.slots) - 1
+	s := int(maphash.Bytes(hashSeed, prefix)) & mask
+	for {
+		e := thiz.slots[s]
+		if e == 0 || bytes.Equal(bindings[2*(e-1)], prefix) {
+			return s
+		}
+		s = (s + 1) & mask
+	}
+}
+
+// remove frees the slot s and moves the following slots of its cluster
+// back, so that every prefix can still be found from the slot it hashes to.
+func (thiz *prefixIndex) remove(bindings [][]byte, s int) {
+	mask := len(thiz.slots) - 1
+	for i := (s + 1) & mask; thiz.slots[i] != 0; i = (i + 1) & mask {
+		home := int(maphash.Bytes(hashSeed, bindings[2*(thiz.slots[i]-1)])) & mask
+		// move the binding in slot i to s if s lies between the
+		// slot its prefix hashes to and i
+		if (i-home)&mask >= (i-s)&mask {
+			thiz.slots[s] = thiz.slots[i]
+			s = i
+		}
+	}
+	thiz.slots[s] = 0
+}
+
+// namespaceScope resolves namespace prefixes to the namespaces
+// bound to them in the scope of the parent of an element.
+type namespaceScope interface {
+	// lookupNamespace returns the namespace bound to the given prefix
+	// (or the default namespace for an empty prefix) or nil if there is none.
+	lookupNamespace(prefix []byte) []byte
+}
+
+// namespaceChecker checks start elements for namespace well-formedness.
+// It keeps the hash sets used for elements with many attributes,
+// so that checking does not allocate once they have grown large enough.
+type namespaceChecker struct {
+	// the namespace declarations of the checked element by prefix,
+	// if it has more than maxPairwiseChecks attributes
+	declarations pairSet
+	// the local names and namespaces of the attributes of the checked element
+	attrNames pairSet
+	indexed   bool
+}
+
+// checkNamespaces checks the start element t for namespace well-formedness
+// (https://www.w3.org/TR/xml-names/#Conformance): the reserved prefixes and
+// namespaces must not be (re)bound, prefixes must not be bound to the empty
+// namespace and all prefixes must be declared. Also, no two attributes may
+// have the same local name and namespace.
+// If t is not namespace-well-formed, the category of the error
+// and a description of it are returned.
+func (thiz *namespaceChecker) checkNamespaces(t *Token, scope namespaceScope) (msg string, category error) {
+	for i := 0; i < len(t.Attr); i++ {
+		attr := &t.Attr[i]
+		if bytes.Equal(attr.Name.Prefix, bsxmlns) {
+			switch {
+			case bytes.Equal(attr.Name.Local, bsxmlns):
+				return "the prefix xmlns must not be declared", ErrReservedNamespace
+			case bytes.Equal(attr.Name.Local, bsxml):
+				if !bytes.Equal(attr.Value, bsxmlNamespace) {
+					return fmt.Sprintf("the prefix xml must not be bound to namespace %s", attr.Value), ErrReservedNamespace
+				}
+			case len(attr.Value) == 0:
+				return fmt.Sprintf("the prefix %s must not be bound to the empty namespace", attr.Name.Local), ErrEmptyNamespace
+			case isReservedNamespace(attr.Value):
+				return fmt.Sprintf("the namespace %s must not be bound to prefix %s", attr.Value, attr.Name.Local), ErrReservedNamespace
+			}
+		} else if len(attr.Name.Prefix) == 0 && bytes.Equal(attr.Name.Local, bsxmlns) && isReservedNamespace(attr.Value) {
+			return fmt.Sprintf("the namespace %s must not be the default namespace", attr.Value), ErrReservedNamespace
+		}
+	}
+	if bytes.Equal(t.Name.Prefix, bsxmlns) {
+		return fmt.Sprintf("element %s must not have the prefix xmlns", t.Name), ErrReservedNamespace
+	}
+	thiz.indexDeclarations(t)
+	if len(t.Name.Prefix) > 0 && thiz.namespaceOfPrefix(t, t.Name.Prefix, scope) == nil {
+		return fmt.Sprintf("namespace prefix of element %s is not declared", t.Name), ErrUndeclaredPrefix
+	}
+	if thiz.indexed {
+		thiz.attrNames.reset(len(t.Attr))
+	}
+	for i := 0; i < len(t.Attr); i++ {
+		attr := &t.Attr[i]
+		ns := thiz.namespaceOfAttr(t, attr, scope)
+		if ns == nil && len(attr.Name.Prefix) > 0 {
+			return fmt.Sprintf("namespace prefix of attribute %s is not declared", attr.Name), ErrUndeclaredPrefix
+		}
+		if thiz.indexed {
+			if j := thiz.attrNames.add(ns, attr.Name.Local, i); j >= 0 {
+				return fmt.Sprintf("attributes %s and %s have the same name", t.Attr[j].Name, attr.Name), ErrDuplicateAttribute
+			}
+			continue
+		}
+		for j := 0; j < i; j++ {
+			other := &t.Attr[j]
+			if bytes.Equal(attr.Name.Local, other.Name.Local) && bytes.Equal(ns, thiz.namespaceOfAttr(t, other, scope)) {
+				return fmt.Sprintf("attributes %s and %s have the same name", other.Name, attr.Name), ErrDuplicateAttribute
+			}
+		}
+	}
+	return "", nil
+}
+
+// indexDeclarations indexes the namespace declarations of t by prefix
+// if t has too many attributes to look them up by scanning all of them.
+func (thiz *namespaceChecker) indexDeclarations(t *Token) {
+	thiz.indexed = len(t.Attr) > maxPairwiseChecks
+	if !thiz.indexed {
+		return
+	}
+	thiz.declarations.reset(len(t.Attr))
+	// add the declarations in reverse, so that the last
+	// declaration of a prefix wins, like when scanning
+	for i := len(t.Attr) - 1; i >= 0; i-- {
+		attr := &t.Attr[i]
+		if bytes.Equal(attr.Name.Prefix, bsxmlns) {
+			thiz.declarations.add(attr.Name.Local, nil, i)
+		}
+	}
+}
+
+func isReservedNamespace(namespace []byte) bool {
+	return bytes.Equal(namespace, bsxmlNamespace) || bytes.Equal(namespace, bsxmlnsNamespace)
+}
+
+// namespaceOfAttr returns the namespace of the given attribute of t.
+func (thiz *namespaceChecker) namespaceOfAttr(t *Token, attr *Attr, scope namespaceScope) []byte {
+	if bytes.Equal(attr.Name.Prefix, bsxmlns) || len(attr.Name.Prefix) == 0 && bytes.Equal(attr.Name.Local, bsxmlns) {
+		return bsxmlnsNamespace
+	}
+	if len(attr.Name.Prefix) == 0 {
+		return nil
+	}
+	return thiz.namespaceOfPrefix(t, attr.Name.Prefix, scope)
+}
+
+// namespaceOfPrefix returns the namespace bound to the given non-empty
+// prefix by a declaration of t or, if there is none, in the given scope.
+func (thiz *namespaceChecker) namespaceOfPrefix(t *Token, prefix []byte, scope namespaceScope) []byte {
+	if bytes.Equal(prefix, bsxml) {
+		return bsxmlNamespace
+	}
+	if thiz.indexed {
+		if i := thiz.declarations.get(prefix, nil); i >= 0 {
+			return t.Attr[i].Value
+		}
+		return scope.lookupNamespace(prefix)
+	}
+	for i := len(t.Attr) - 1; i >= 0; i-- {
+		attr := &t.Attr[i]
+		if bytes.Equal(attr.Name.Prefix, bsxmlns) && bytes.Equal(attr.Name.Local, prefix) {
+			return attr.Value
+		}
+	}
+	return scope.lookupNamespace(prefix)
+}
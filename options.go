@@ -0,0 +1,166 @@
+package gosaxml
+
+// DecoderOption configures optional behavior of a Decoder.
+// Options are passed to NewDecoder.
+type DecoderOption func(*decoder)
+
+// WithComments makes the Decoder emit a TokenTypeComment token for
+// every comment instead of silently skipping it.
+func WithComments() DecoderOption {
+	return func(d *decoder) {
+		d.comments = true
+	}
+}
+
+// WithEntityDecoding makes the Decoder resolve the predefined entity
+// references (&lt; &gt; &amp; &apos; &quot;) and character references
+// (like &#8364; or &#x20AC;) in texts and attribute values into UTF-8.
+// Malformed or undefined references result in an error.
+// By default, references are passed through verbatim.
+func WithEntityDecoding() DecoderOption {
+	return func(d *decoder) {
+		d.entities = true
+	}
+}
+
+// WithNamespaces makes the Decoder resolve the namespace URI of every element
+// and attribute name according to the namespace declarations in scope and
+// store it in Name.Namespace.
+func WithNamespaces() DecoderOption {
+	return func(d *decoder) {
+		d.namespaces = true
+		if d.nsBindings == nil {
+			d.nsBindings = make([][]byte, 0, 64)
+		}
+	}
+}
+
+// WithNamespaceChecks makes the Decoder check that the input is
+// namespace-well-formed (https://www.w3.org/TR/xml-names/#Conformance),
+// which results in a SyntaxError of the categories ErrUndeclaredPrefix,
+// ErrReservedNamespace, ErrEmptyNamespace or ErrDuplicateAttribute
+// otherwise. It implies WithNamespaces.
+func WithNamespaceChecks() DecoderOption {
+	return func(d *decoder) {
+		WithNamespaces()(d)
+		d.checkNamespaces = true
+	}
+}
+
+// WithStrict makes the Decoder check that the input is a well-formed
+// XML 1.0 document (https://www.w3.org/TR/xml/#sec-well-formed): end elements
+// must match their start element, there must be exactly one root element,
+// there must be no text or CDATA section outside of it, no element may have
+// two attributes of the same name and the input must not end before the root
+// element is closed. Whitespace before the XML declaration, which is
+// tolerated otherwise, is rejected as well, and so are processing
+// instructions with a reserved target like "XML" or "xml:x".
+// Violations result in a SyntaxError of the categories
+// ErrMismatchedEndElement, ErrMisplacedContent, ErrDuplicateAttribute,
+// ErrInvalidName or ErrUnexpectedEOF. The content skipped by
+// Decoder.Skip is not checked.
+func WithStrict() DecoderOption {
+	return func(d *decoder) {
+		d.strict = true
+	}
+}
+
+// WithCharacterChecks makes the Decoder check that all element, attribute
+// and processing instruction names match the Name production
+// (https://www.w3.org/TR/xml/#NT-Name) and that all texts, CDATA sections,
+// comments, processing instructions, directives and attribute values only
+// consist of characters matching the Char production
+// (https://www.w3.org/TR/xml/#NT-Char) in valid UTF-8. This includes
+// whitespace-only texts and the whitespace within tags, where only space,
+// tab, carriage return and line feed are accepted. Input in other encodings
+// must be well-formed in them, without bytes undefined in its character set.
+// Violations result in a SyntaxError of the categories ErrInvalidName
+// or ErrInvalidCharacter.
+func WithCharacterChecks() DecoderOption {
+	return func(d *decoder) {
+		d.checkCharacters = true
+	}
+}
+
+// WithCharset makes the Decoder decode input without a byte order mark
+// in the given single-byte character set (see LookupCharset) regardless
+// of its encoding declaration. A nil Charset is ignored.
+// Bytes which are undefined in the character set are decoded as U+FFFD,
+// unless WithCharacterChecks rejects them.
+func WithCharset(c *Charset) DecoderOption {
+	return func(d *decoder) {
+		d.charset = c
+	}
+}
+
+// WithMaxDepth sets the maximum element nesting depth, beyond which
+// decoding fails with an error. It defaults to DefaultMaxDepth,
+// which is also used if maxDepth is not positive.
+func WithMaxDepth(maxDepth int) DecoderOption {
+	return func(d *decoder) {
+		if maxDepth <= 0 {
+			maxDepth = DefaultMaxDepth
+		}
+		d.maxDepth = maxDepth
+	}
+}
+
+// WithPositionTracking makes the Decoder track the line and column
+// of every decoded Token, which are then available via Decoder.Position,
+// and of every SyntaxError.
+func WithPositionTracking() DecoderOption {
+	return func(d *decoder) {
+		d.trackPositions = true
+	}
+}
+
+// WithLossless makes the Decoder record everything needed to reproduce
+// the input byte-for-byte with an Encoder in lossless mode (see
+// Encoder.Lossless): the whitespace inside of tags (Attr.Space, Attr.Eq
+// and Token.Space), the verbatim data of processing instructions, all
+// whitespace-only texts and all comments.
+// It should not be combined with WithEntityDecoding.
+func WithLossless() DecoderOption {
+	return func(d *decoder) {
+		d.lossless = true
+		d.comments = true
+	}
+}
+
+// WithReadBufferSize sets the size of the buffer into which the Decoder
+// reads from its io.Reader. Larger buffers mean fewer Read calls for big
+// documents, smaller ones save memory for tiny streams.
+// It defaults to DefaultReadBufferSize and is at least MinReadBufferSize.
+func WithReadBufferSize(size int) DecoderOption {
+	return func(d *decoder) {
+		if size < MinReadBufferSize {
+			size = MinReadBufferSize
+		}
+		d.buf = make([]byte, size+simdWidth)
+	}
+}
+
+// WithInitialCapacities sets the initial capacities of the buffer holding
+// the names, texts and attribute values of the currently open elements and
+// of the slice holding their attributes. Both grow as needed and are reused
+// across Reset, so this only avoids reallocations for large documents.
+// A negative capacity is ignored and keeps the default.
+func WithInitialCapacities(bytes, attributes int) DecoderOption {
+	return func(d *decoder) {
+		if bytes >= 0 {
+			d.bb = make([]byte, 0, bytes)
+		}
+		if attributes >= 0 {
+			d.attrs = make([]Attr, 0, attributes)
+		}
+	}
+}
+
+// WithLimits restricts the resources the Decoder spends on its input.
+// Exceeding a limit results in a LimitError.
+func WithLimits(limits Limits) DecoderOption {
+	return func(d *decoder) {
+		d.limits = limits
+		d.limited = limits != Limits{}
+	}
+}
@@ -0,0 +1,83 @@
+package gosaxml
+
+import (
+	"bytes"
+	"hash/maphash"
+)
+
+// maxPairwiseChecks is the number of attributes up to which duplicates are
+// found by comparing all pairs, which is faster than hashing for the few
+// attributes of most elements.
+const maxPairwiseChecks = 8
+
+// hashSeed randomizes the hashes of pairSet and prefixIndex,
+// so that hostile input cannot provoke collisions.
+var hashSeed = maphash.MakeSeed()
+
+// pairSet is an open-addressing hash set of pairs of byte slices, like the
+// prefix and local name of an attribute, which finds duplicates among n pairs
+// in linear time. Its storage is reused, so it does not allocate once it has
+// grown large enough.
+type pairSet struct {
+	// 1 + the index into entries, or 0 for a free slot
+	slots   []int32
+	entries []pairEntry
+}
+
+type pairEntry struct {
+	a, b  []byte
+	value int
+}
+
+// reset empties the set and prepares it for (at most) n pairs.
+func (thiz *pairSet) reset(n int) {
+	size := 16
+	for size < 2*n {
+		size *= 2
+	}
+	if cap(thiz.slots) < size {
+		thiz.slots = make([]int32, size)
+	} else {
+		thiz.slots = thiz.slots[:size]
+		clear(thiz.slots)
+	}
+	thiz.entries = thiz.entries[:0]
+}
+
+// add adds the pair (a, b) with the given value and returns -1 or, if the
+// set already contains the pair, leaves it unchanged and returns its value.
+func (thiz *pairSet) add(a, b []byte, value int) int {
+	s := thiz.slot(a, b)
+	if e := thiz.slots[s]; e > 0 {
+		return thiz.entries[e-1].value
+	}
+	thiz.entries = append(thiz.entries, pairEntry{a: a, b: b, value: value})
+	thiz.slots[s] = int32(len(thiz.entries))
+	return -1
+}
+
+// get returns the value of the pair (a, b), or -1 if the set does not contain it.
+func (thiz *pairSet) get(a, b []byte) int {
+	if e := thiz.slots[thiz.slot(a, b)]; e > 0 {
+		return thiz.entries[e-1].value
+	}
+	return -1
+}
+
+// slot returns the index of the slot holding the pair (a, b)
+// or of the free slot it belongs into.
+func (thiz *pairSet) slot(a, b []byte) int {
+	mask := len(thiz.slots) - 1
+	s := int(maphash.Bytes(hashSeed, a)*31+maphash.Bytes(hashSeed, b)) & mask
+	for {
+		e := thiz.slots[s]
+		if e == 0 {
+			return s
+		}
+		entry := &thiz.entries[e-1]
+		if bytes.Equal(entry.a, a) && bytes.Equal(entry.b, b) {
+			return s
+		}
+		s = (s + 1) & mask
+	}
+}
@@ -0,0 +1,196 @@
+package gosaxml
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// PseudoAttrIterator iterates over the pseudo-attributes name="value" (or
+// name='value') in the data of a processing instruction, like the href and
+// type of <?xml-stylesheet href="a.xsl" type="text/xsl"?>
+// (https://www.w3.org/TR/xml-stylesheet/#NT-PseudoAtt).
+// Iterating does not allocate.
+type PseudoAttrIterator struct {
+	data  []byte
+	count int
+	msg   string
+}
+
+// NewPseudoAttrIterator returns an iterator over the pseudo-attributes
+// in the ByteData of the processing instruction t. The returned attributes
+// refer to t.ByteData and are only valid as long as it is.
+func NewPseudoAttrIterator(t *Token) PseudoAttrIterator {
+	return PseudoAttrIterator{data: t.ByteData}
+}
+
+// Next stores the next pseudo-attribute in attr and reports whether there
+// is one. Like attribute values decoded without WithEntityDecoding, the
+// value is returned verbatim. Space and Eq are set as for attributes
+// decoded in lossless mode. Next returns false at the end of the data
+// and if it is malformed, which is reported by Err.
+func (thiz *PseudoAttrIterator) Next(attr *Attr) bool {
+	if thiz.msg != "" {
+		return false
+	}
+	rest := trimLeftSpace(thiz.data)
+	if len(rest) == 0 {
+		thiz.data = rest
+		return false
+	}
+	if len(rest) == len(thiz.data) && thiz.count > 0 {
+		thiz.msg = "missing whitespace between pseudo-attributes"
+		return false
+	}
+	rest, ok := nextPseudoAttr(thiz.data, attr)
+	if !ok {
+		thiz.msg = "malformed pseudo-attribute"
+		return false
+	}
+	if !isName(attr.Name.Local) {
+		thiz.msg = fmt.Sprintf("invalid pseudo-attribute name %q", attr.Name.Local)
+		return false
+	}
+	thiz.data = rest
+	thiz.count++
+	return true
+}
+
+// Err returns the error of the category ErrInvalidAttribute which stopped
+// the iteration, or nil if all pseudo-attributes have been read.
+func (thiz *PseudoAttrIterator) Err() error {
+	if thiz.msg == "" {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidAttribute, thiz.msg)
+}
+
+// trimLeftSpace returns b without leading whitespace.
+func trimLeftSpace(b []byte) []byte {
+	for len(b) > 0 && isWhitespace(b[0]) {
+		b = b[1:]
+	}
+	return b
+}
+
+// nextPseudoAttr parses the pseudo-attribute at the start of data after
+// optional whitespace into attr and returns the rest of data. It reports
+// false if there is no well-formed pseudo-attribute.
+func nextPseudoAttr(data []byte, attr *Attr) ([]byte, bool) {
+	rest := trimLeftSpace(data)
+	space := data[:len(data)-len(rest)]
+	i := 0
+	for i < len(rest) && !isWhitespace(rest[i]) && rest[i] != '=' {
+		i++
+	}
+	if i == 0 {
+		return data, false
+	}
+	name := rest[:i]
+	eq := rest[i:]
+	rest = trimLeftSpace(eq)
+	if len(rest) == 0 || rest[0] != '=' {
+		return data, false
+	}
+	rest = trimLeftSpace(rest[1:])
+	if len(rest) == 0 || rest[0] != '"' && rest[0] != '\'' {
+		return data, false
+	}
+	j := bytes.IndexByte(rest[1:], rest[0])
+	if j < 0 {
+		return data, false
+	}
+	*attr = Attr{
+		Name:        Name{Local: name},
+		Value:       rest[1 : j+1],
+		SingleQuote: rest[0] == '\'',
+		Space:       space,
+		Eq:          eq[:len(eq)-len(rest)],
+	}
+	return rest[j+2:], true
+}
+
+// ProcInstBuilder builds processing instruction tokens from pseudo-attributes,
+// like <?xml-stylesheet href="a.xsl" type="text/xsl"?>. Its buffer is reused,
+// so building does not allocate once it has grown large enough.
+type ProcInstBuilder struct {
+	// Escape makes Add replace the characters '&', '<', '>' and '"' in values
+	// by entity references. Otherwise, values are written verbatim and
+	// enclosed in single quotes if they contain a double quote. Add then
+	// rejects values which contain both quotes or the "?>" ending the
+	// processing instruction.
+	Escape bool
+
+	buf []byte
+}
+
+// Reset discards the pseudo-attributes added so far.
+func (thiz *ProcInstBuilder) Reset() {
+	thiz.buf = thiz.buf[:0]
+}
+
+// Add appends the pseudo-attribute name="value". Without Escape, it returns
+// an error of the category ErrInvalidAttribute and appends nothing if the
+// value cannot be written verbatim.
+func (thiz *ProcInstBuilder) Add(name, value []byte) error {
+	quote := byte('"')
+	if !thiz.Escape {
+		if bytes.IndexByte(value, '"') >= 0 {
+			quote = '\''
+			if bytes.IndexByte(value, '\'') >= 0 {
+				return fmt.Errorf("%w: value %q of pseudo-attribute %s contains both quotes", ErrInvalidAttribute, value, name)
+			}
+		}
+		if bytes.Contains(value, questAngleClose) {
+			return fmt.Errorf("%w: value %q of pseudo-attribute %s contains \"?>\"", ErrInvalidAttribute, value, name)
+		}
+	}
+	if len(thiz.buf) > 0 {
+		thiz.buf = append(thiz.buf, ' ')
+	}
+	thiz.buf = append(thiz.buf, name...)
+	thiz.buf = append(thiz.buf, '=', quote)
+	if thiz.Escape {
+		thiz.buf = appendEscapedPseudoAttr(thiz.buf, value)
+	} else {
+		thiz.buf = append(thiz.buf, value...)
+	}
+	thiz.buf = append(thiz.buf, quote)
+	return nil
+}
+
+// Token stores the processing instruction with the given target and the
+// pseudo-attributes added so far in t. Its ByteData refers to the buffer
+// of the builder and is only valid until the next call of Reset or Add.
+func (thiz *ProcInstBuilder) Token(target []byte, t *Token) {
+	*t = Token{
+		Kind:     TokenTypeProcInst,
+		Name:     Name{Local: target},
+		ByteData: thiz.buf,
+	}
+}
+
+// appendEscapedPseudoAttr appends src to dst with the characters '&', '<',
+// '>' and '"' replaced by entity references, so that it can be enclosed in
+// double quotes and cannot end the processing instruction.
+func appendEscapedPseudoAttr(dst, src []byte) []byte {
+	last := 0
+	for i, c := range src {
+		var esc []byte
+		switch c {
+		case '&':
+			esc = escAmp
+		case '<':
+			esc = escLt
+		case '>':
+			esc = escGt
+		case '"':
+			esc = escQuot
+		default:
+			continue
+		}
+		dst = append(dst, src[last:i]...)
+		dst = append(dst, esc...)
+		last = i + 1
+	}
+	return append(dst, src[last:]...)
+}
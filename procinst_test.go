@@ -0,0 +1,184 @@
+package gosaxml_test
+
+import (
+	"bytes"
+	"github.com/HBTGmbH/gosaxml"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func BenchmarkPseudoAttrIterator(b *testing.B) {
+	tk := gosaxml.Token{Kind: gosaxml.TokenTypeProcInst, Name: gosaxml.Name{Local: []byte("xml-stylesheet")},
+		ByteData: []byte(`href="a.xsl" type="text/xsl" media='screen'`)}
+	var builder gosaxml.ProcInstBuilder
+	var attr gosaxml.Attr
+	var out gosaxml.Token
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		builder.Reset()
+		it := gosaxml.NewPseudoAttrIterator(&tk)
+		for it.Next(&attr) {
+			assert.Nil(b, builder.Add(attr.Name.Local, attr.Value))
+		}
+		builder.Token(tk.Name.Local, &out)
+	}
+}
+
+func TestPseudoAttrIterator(t *testing.T) {
+	// given
+	dec := gosaxml.NewDecoder(strings.NewReader(`<?xml-stylesheet href="a.xsl"  type = 'text/xsl'?><a/>`), gosaxml.WithLossless())
+	var tk gosaxml.Token
+	assert.Nil(t, dec.NextToken(&tk))
+	var attrs []gosaxml.Attr
+	var attr gosaxml.Attr
+
+	// when
+	it := gosaxml.NewPseudoAttrIterator(&tk)
+	for it.Next(&attr) {
+		attrs = append(attrs, attr)
+	}
+
+	// then
+	assert.Nil(t, it.Err())
+	assert.Equal(t, []gosaxml.Attr{
+		{Name: gosaxml.Name{Local: []byte("href")}, Value: []byte("a.xsl"), Space: []byte(" "), Eq: []byte("=")},
+		{Name: gosaxml.Name{Local: []byte("type")}, Value: []byte("text/xsl"), SingleQuote: true, Space: []byte("  "), Eq: []byte(" = ")},
+	}, attrs)
+}
+
+func TestPseudoAttrIteratorEmpty(t *testing.T) {
+	// given
+	tk := gosaxml.Token{Kind: gosaxml.TokenTypeProcInst, Name: gosaxml.Name{Local: []byte("pi")}, ByteData: []byte("  ")}
+	var attr gosaxml.Attr
+
+	// when
+	it := gosaxml.NewPseudoAttrIterator(&tk)
+	next := it.Next(&attr)
+
+	// then
+	assert.False(t, next)
+	assert.Nil(t, it.Err())
+}
+
+func TestPseudoAttrIteratorMalformed(t *testing.T) {
+	for name, data := range map[string]string{
+		"missing whitespace": `a="1"b="2"`,
+		"missing value":      `a="1" b`,
+		"missing quote":      `a=1`,
+		"unterminated value": `a="1`,
+		"invalid name":       `1a="1"`,
+		"text":               `not pseudo-attributes`,
+	} {
+		// given
+		tk := gosaxml.Token{Kind: gosaxml.TokenTypeProcInst, Name: gosaxml.Name{Local: []byte("pi")}, ByteData: []byte(data)}
+		var attr gosaxml.Attr
+
+		// when
+		it := gosaxml.NewPseudoAttrIterator(&tk)
+		for it.Next(&attr) {
+		}
+
+		// then
+		assert.ErrorIs(t, it.Err(), gosaxml.ErrInvalidAttribute, name)
+		assert.False(t, it.Next(&attr), name)
+	}
+}
+
+func TestProcInstBuilder(t *testing.T) {
+	for expected, escape := range map[string]bool{
+		`<?xml-stylesheet href="a.xsl?x=1&y=2" title='say "hi"'?>`:               false,
+		`<?xml-stylesheet href="a.xsl?x=1&amp;y=2" title="say &quot;hi&quot;"?>`: true,
+	} {
+		// given
+		builder := gosaxml.ProcInstBuilder{Escape: escape}
+		assert.Nil(t, builder.Add([]byte("ignored"), []byte("x")))
+		builder.Reset()
+		w := &bytes.Buffer{}
+		enc := gosaxml.NewEncoder(w)
+		var tk gosaxml.Token
+
+		// when
+		err1 := builder.Add([]byte("href"), []byte("a.xsl?x=1&y=2"))
+		err2 := builder.Add([]byte("title"), []byte(`say "hi"`))
+		builder.Token([]byte("xml-stylesheet"), &tk)
+		assert.Nil(t, enc.EncodeToken(&tk))
+		assert.Nil(t, enc.Flush())
+
+		// then
+		assert.Nil(t, err1)
+		assert.Nil(t, err2)
+		assert.Equal(t, expected, w.String())
+	}
+}
+
+func TestProcInstBuilderEscapesEnd(t *testing.T) {
+	// given
+	builder := gosaxml.ProcInstBuilder{Escape: true}
+	var tk gosaxml.Token
+
+	// when
+	err := builder.Add([]byte("a"), []byte("<?x?>"))
+	builder.Token([]byte("pi"), &tk)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, gosaxml.TokenTypeProcInst, int(tk.Kind))
+	assert.Equal(t, `a="&lt;?x?&gt;"`, string(tk.ByteData))
+}
+
+func TestProcInstBuilderUnrepresentable(t *testing.T) {
+	for name, value := range map[string]string{
+		"both quotes": `say "it's"`,
+		"end":         "<?x?>",
+	} {
+		// given
+		var builder gosaxml.ProcInstBuilder
+		assert.Nil(t, builder.Add([]byte("a"), []byte("1")))
+		var tk gosaxml.Token
+
+		// when
+		err := builder.Add([]byte("b"), []byte(value))
+		builder.Token([]byte("pi"), &tk)
+
+		// then
+		assert.ErrorIs(t, err, gosaxml.ErrInvalidAttribute, name)
+		assert.Equal(t, `a="1"`, string(tk.ByteData), name)
+	}
+}
+
+func TestRewriteStylesheet(t *testing.T) {
+	// given
+	doc := "<?xml version=\"1.0\"?>\n<?xml-stylesheet type=\"text/xsl\" href=\"old.xsl\"?>\n<a/>"
+	dec := gosaxml.NewDecoder(strings.NewReader(doc), gosaxml.WithLossless())
+	w := &bytes.Buffer{}
+	enc := gosaxml.NewEncoder(w)
+	enc.Lossless = true
+	var builder gosaxml.ProcInstBuilder
+	var tk gosaxml.Token
+	var attr gosaxml.Attr
+
+	// when
+	for dec.NextToken(&tk) == nil {
+		if tk.Kind == gosaxml.TokenTypeProcInst && string(tk.Name.Local) == "xml-stylesheet" {
+			builder.Reset()
+			it := gosaxml.NewPseudoAttrIterator(&tk)
+			for it.Next(&attr) {
+				if string(attr.Name.Local) == "href" {
+					attr.Value = []byte("new.xsl")
+				}
+				assert.Nil(t, builder.Add(attr.Name.Local, attr.Value))
+			}
+			assert.Nil(t, it.Err())
+			builder.Token(tk.Name.Local, &tk)
+		}
+		assert.Nil(t, enc.EncodeToken(&tk))
+	}
+	assert.Nil(t, enc.Flush())
+
+	// then
+	assert.Equal(t, "<?xml version=\"1.0\"?>\n<?xml-stylesheet type=\"text/xsl\" href=\"new.xsl\"?>\n<a/>", w.String())
+}
@@ -9,8 +9,17 @@ func onlySpaces16([]uint8) byte
 //go:noescape
 func openAngleBracket32([]uint8) byte
 
+//go:noescape
+func closeBracket16([]uint8) byte
+
+//go:noescape
+func closeBracket32([]uint8) byte
+
 //go:noescape
 func onlySpaces32([]uint8) byte
 
 //go:noescape
 func seperator32([]uint8) byte
+
+//go:noescape
+func countNewlines32(buf []uint8) int
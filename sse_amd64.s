@@ -6,6 +6,18 @@ DATA ·oab<>+16(SB)/8, $0x3C3C3C3C3C3C3C3C
 DATA ·oab<>+24(SB)/8, $0x3C3C3C3C3C3C3C3C
 GLOBL ·oab<>(SB), NOPTR+RODATA, $32
 
+DATA ·cb<>+0(SB)/8, $0x5D5D5D5D5D5D5D5D
+DATA ·cb<>+8(SB)/8, $0x5D5D5D5D5D5D5D5D
+DATA ·cb<>+16(SB)/8, $0x5D5D5D5D5D5D5D5D
+DATA ·cb<>+24(SB)/8, $0x5D5D5D5D5D5D5D5D
+GLOBL ·cb<>(SB), NOPTR+RODATA, $32
+
+DATA ·nl<>+0(SB)/8, $0x0A0A0A0A0A0A0A0A
+DATA ·nl<>+8(SB)/8, $0x0A0A0A0A0A0A0A0A
+DATA ·nl<>+16(SB)/8, $0x0A0A0A0A0A0A0A0A
+DATA ·nl<>+24(SB)/8, $0x0A0A0A0A0A0A0A0A
+GLOBL ·nl<>(SB), NOPTR+RODATA, $32
+
 DATA ·spc<>+0(SB)/8, $0x2020202020202020
 DATA ·spc<>+8(SB)/8, $0x2020202020202020
 DATA ·spc<>+16(SB)/8, $0x2020202020202020
@@ -49,6 +61,25 @@ TEXT ·openAngleBracket32(SB),NOSPLIT, $0
     VZEROUPPER // <- https://i.stack.imgur.com/dGpbi.png
     RET
 
+TEXT ·closeBracket16(SB),NOSPLIT, $0
+    MOVQ arg+0(FP), DI
+    MOVOU (DI), X0
+    PCMPEQB ·cb<>(SB), X0
+    PMOVMSKB X0, AX
+    TZCNTW AX, AX
+    MOVB AX, ret+24(FP)
+    RET
+
+TEXT ·closeBracket32(SB),NOSPLIT, $0
+    MOVQ arg+0(FP), DI
+    VMOVDQU (DI), Y0
+    VPCMPEQB ·cb<>(SB), Y0, Y0
+    VPMOVMSKB Y0, AX
+    TZCNTL AX, AX
+    MOVB AX, ret+24(FP)
+    VZEROUPPER // <- https://i.stack.imgur.com/dGpbi.png
+    RET
+
 TEXT ·onlySpaces16(SB),NOSPLIT, $0
     MOVQ arg+0(FP), DI
     MOVOU (DI), X0
@@ -104,3 +135,26 @@ TEXT ·seperator32(SB),NOSPLIT, $0
     MOVB AX, ret+24(FP)
     VZEROUPPER // <- https://i.stack.imgur.com/dGpbi.png
     RET
+
+// counts the '\n' bytes in all whole 32-byte blocks of buf
+TEXT ·countNewlines32(SB),NOSPLIT, $0
+    MOVQ buf_base+0(FP), SI
+    MOVQ buf_len+8(FP), CX
+    SHRQ $5, CX
+    XORQ AX, AX
+    VMOVDQU ·nl<>(SB), Y1
+loop:
+    TESTQ CX, CX
+    JZ done
+    VMOVDQU (SI), Y0
+    VPCMPEQB Y1, Y0, Y0
+    VPMOVMSKB Y0, DX
+    POPCNTL DX, DX
+    ADDQ DX, AX
+    ADDQ $32, SI
+    DECQ CX
+    JMP loop
+done:
+    MOVQ AX, ret+24(FP)
+    VZEROUPPER // <- https://i.stack.imgur.com/dGpbi.png
+    RET
@@ -11,6 +11,18 @@ func TestOpenAngleBracket16(t *testing.T) {
 	assert.Equal(t, byte(16), openAngleBracket16(slice(16, ' ')))
 }
 
+func TestCloseBracket16(t *testing.T) {
+	assert.Equal(t, byte(3), closeBracket16(at(slice(16, ' '), 3, ']')))
+	assert.Equal(t, byte(15), closeBracket16(at(slice(16, ' '), 15, ']')))
+	assert.Equal(t, byte(16), closeBracket16(slice(16, '[')))
+}
+
+func TestCloseBracket32(t *testing.T) {
+	assert.Equal(t, byte(3), closeBracket32(at(slice(32, ' '), 3, ']')))
+	assert.Equal(t, byte(31), closeBracket32(at(slice(32, ' '), 31, ']')))
+	assert.Equal(t, byte(32), closeBracket32(slice(32, '[')))
+}
+
 func TestOnlySpaces16(t *testing.T) {
 	assert.Equal(t, byte(16), onlySpaces16(slice(16, ' ')))
 	assert.Equal(t, byte(16), onlySpaces16(slice(16, '\t')))
@@ -0,0 +1,98 @@
+package gosaxml
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// checkRootElement checks that a start element at the top level
+// is the first and only root element of the document.
+func (thiz *decoder) checkRootElement() error {
+	if thiz.root {
+		return thiz.syntaxError(ErrMisplacedContent, "multiple root elements")
+	}
+	thiz.root = true
+	return nil
+}
+
+// checkProcInstTarget checks that the target of a processing instruction
+// other than the XML declaration is not reserved, that is neither "xml" in
+// another case (https://www.w3.org/TR/xml/#NT-PITarget) nor prefixed by it.
+func (thiz *decoder) checkProcInstTarget(name Name) error {
+	if bytes.EqualFold(name.Prefix, bsxml) || name.Prefix == nil && bytes.EqualFold(name.Local, bsxml) && !bytes.Equal(name.Local, bsxml) {
+		return thiz.syntaxError(ErrInvalidName, fmt.Sprintf("reserved processing instruction target %s", name))
+	}
+	return nil
+}
+
+// checkEndElement checks that the given end element
+// matches the innermost open element.
+func (thiz *decoder) checkEndElement(name Name) error {
+	open := thiz.names[thiz.top]
+	if !bytes.Equal(name.Local, open.Local) || !bytes.Equal(name.Prefix, open.Prefix) {
+		return thiz.syntaxError(ErrMismatchedEndElement, fmt.Sprintf("end element %s does not match start element %s", name, open))
+	}
+	return nil
+}
+
+// checkTopLevelText checks that the text decoded by decodeText outside of
+// the root element only consists of whitespace. The text starts at index i
+// of bb if the input ended within it.
+func (thiz *decoder) checkTopLevelText(t *Token, i int, cntn bool, err error) error {
+	var text []byte
+	switch {
+	case err == io.EOF:
+		// the input may end with whitespace
+		text = thiz.bb[i:len(thiz.bb)]
+		thiz.betweenTokens = true
+	case err != nil || cntn:
+		return err
+	default:
+		text = t.ByteData
+	}
+	if !isWhitespaces(text) {
+		return thiz.syntaxError(ErrMisplacedContent, "text outside of the root element")
+	}
+	return err
+}
+
+// checkDuplicateAttributes checks that no two of the given
+// attributes have the same name.
+func (thiz *decoder) checkDuplicateAttributes(attrs []Attr) error {
+	if len(attrs) <= maxPairwiseChecks {
+		for i := 1; i < len(attrs); i++ {
+			for j := 0; j < i; j++ {
+				if bytes.Equal(attrs[i].Name.Local, attrs[j].Name.Local) && bytes.Equal(attrs[i].Name.Prefix, attrs[j].Name.Prefix) {
+					return thiz.duplicateAttributeError(&attrs[i])
+				}
+			}
+		}
+		return nil
+	}
+	thiz.attrNames.reset(len(attrs))
+	for i := 0; i < len(attrs); i++ {
+		if thiz.attrNames.add(attrs[i].Name.Prefix, attrs[i].Name.Local, i) >= 0 {
+			return thiz.duplicateAttributeError(&attrs[i])
+		}
+	}
+	return nil
+}
+
+func (thiz *decoder) duplicateAttributeError(attr *Attr) error {
+	return thiz.syntaxError(ErrDuplicateAttribute, fmt.Sprintf("duplicate attribute %s", attr.Name))
+}
+
+// checkEOF turns the end of the input into a SyntaxError
+// if the document is not complete.
+func (thiz *decoder) checkEOF() error {
+	switch {
+	case thiz.top > 0:
+		return thiz.syntaxError(ErrUnexpectedEOF, fmt.Sprintf("unexpected EOF with %d open elements", thiz.top))
+	case !thiz.betweenTokens:
+		return thiz.syntaxError(ErrUnexpectedEOF, "unexpected EOF within markup")
+	case !thiz.root:
+		return thiz.syntaxError(ErrUnexpectedEOF, "unexpected EOF before the root element")
+	}
+	return io.EOF
+}
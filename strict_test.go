@@ -0,0 +1,117 @@
+package gosaxml_test
+
+import (
+	"fmt"
+	"github.com/HBTGmbH/gosaxml"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestStrictWellFormed(t *testing.T) {
+	for _, doc := range []string{
+		`<a/>`,
+		"<?xml version=\"1.0\"?>\n<!DOCTYPE a>\n<!-- c -->\n<a><b x=\"1\" y=\"2\">t</b><![CDATA[d]]></a>\n<?pi?>\n<!-- c -->\n",
+		`<a x="1" p:x="2"><b></b></a>`,
+		`<p:a xmlns:p="urn:p"></p:a>`,
+		`<?xml-stylesheet href="a.xsl"?><a><?xmlx?></a>`,
+	} {
+		// when
+		_, err := decodeTokens(doc, gosaxml.WithStrict())
+		_, bytesErr := decodeAllTokens(gosaxml.NewBytesDecoder([]byte(doc), gosaxml.WithStrict()))
+		_, losslessErr := decodeTokens(doc, gosaxml.WithStrict(), gosaxml.WithLossless())
+
+		// then
+		assert.Nil(t, err, doc)
+		assert.Nil(t, bytesErr, doc)
+		assert.Nil(t, losslessErr, doc)
+	}
+}
+
+func TestStrictViolations(t *testing.T) {
+	for name, tc := range map[string]struct {
+		doc      string
+		category error
+	}{
+		"mismatched end element":  {`<a><b></a></b>`, gosaxml.ErrMismatchedEndElement},
+		"mismatched prefix":       {`<p:a></q:a>`, gosaxml.ErrMismatchedEndElement},
+		"multiple roots":          {`<a/><b/>`, gosaxml.ErrMisplacedContent},
+		"text before root":        {`x<a/>`, gosaxml.ErrMisplacedContent},
+		"text after root":         {`<a/>x`, gosaxml.ErrMisplacedContent},
+		"text at end of input":    {"<a/>\n  x  ", gosaxml.ErrMisplacedContent},
+		"CDATA outside of root":   {`<![CDATA[x]]><a/>`, gosaxml.ErrMisplacedContent},
+		"DOCTYPE after root":      {`<a/><!DOCTYPE a>`, gosaxml.ErrMisplacedContent},
+		"duplicate attribute":     {`<a x="1" x="2"/>`, gosaxml.ErrDuplicateAttribute},
+		"duplicate prefixed attr": {`<a p:x="1" p:x="2"/>`, gosaxml.ErrDuplicateAttribute},
+		"open elements":           {`<a><b>`, gosaxml.ErrUnexpectedEOF},
+		"unclosed start element":  {`<a`, gosaxml.ErrUnexpectedEOF},
+		"unclosed comment":        {`<a/><!-- x`, gosaxml.ErrUnexpectedEOF},
+		"unclosed PI":             {`<a/><?pi`, gosaxml.ErrUnexpectedEOF},
+		"empty input":             {``, gosaxml.ErrUnexpectedEOF},
+		"no root element":         {"<?pi?>\n", gosaxml.ErrUnexpectedEOF},
+		"upper case XML target":   {`<?XML version="1.0"?><a/>`, gosaxml.ErrInvalidName},
+		"mixed case xml target":   {`<a><?xMl?></a>`, gosaxml.ErrInvalidName},
+		"xml prefixed target":     {`<a/><?xml:x?>`, gosaxml.ErrInvalidName},
+	} {
+		// when
+		_, err := decodeTokens(tc.doc, gosaxml.WithStrict())
+		_, bytesErr := decodeAllTokens(gosaxml.NewBytesDecoder([]byte(tc.doc), gosaxml.WithStrict()))
+
+		// then
+		t.Run(name, func(t *testing.T) {
+			assert.ErrorIs(t, err, tc.category)
+			assert.ErrorIs(t, bytesErr, tc.category)
+		})
+	}
+}
+
+func TestStrictErrorMessages(t *testing.T) {
+	for doc, msg := range map[string]string{
+		`<a><b></c></a>`: "end element c does not match start element b (line 1, column 11, offset 10, path /a/b)",
+		`<a><b>`:         "unexpected EOF with 2 open elements (line 1, column 7, offset 6, path /a/b)",
+	} {
+		// when
+		_, err := decodeTokens(doc, gosaxml.WithStrict(), gosaxml.WithPositionTracking())
+
+		// then
+		assert.EqualError(t, err, msg)
+	}
+}
+
+func TestStrictDisabled(t *testing.T) {
+	// when
+	_, err := decodeTokens(`x<a x="1" x="2"><b></a></b><c/>`)
+
+	// then
+	assert.Nil(t, err)
+}
+
+func TestStrictManyAttributes(t *testing.T) {
+	for doc, category := range map[string]error{
+		manyAttributes(`x%d="1"`, 50000) + `/>`:                  nil,
+		manyAttributes(`p%[1]d:x%[1]d="1"`, 50000) + ` x0="2"/>`: nil,
+		manyAttributes(`x%d="1"`, 50000) + ` x49999="2"/>`:       gosaxml.ErrDuplicateAttribute,
+		manyAttributes(`p:x%d="1"`, 50000) + ` p:x0="2"/>`:       gosaxml.ErrDuplicateAttribute,
+	} {
+		// when
+		_, err := decodeTokens(doc, gosaxml.WithStrict())
+
+		// then
+		if category == nil {
+			assert.Nil(t, err)
+		} else {
+			assert.ErrorIs(t, err, category)
+		}
+	}
+}
+
+// manyAttributes returns an unclosed start tag with n attributes, which are
+// given by the format applied to their index.
+func manyAttributes(format string, n int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<a")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, " "+format, i)
+	}
+	return b.String()
+}
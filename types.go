@@ -5,6 +5,11 @@ package gosaxml
 type Name struct {
 	Local  []byte
 	Prefix []byte
+
+	// Namespace is the namespace URI the name resolves to. It is only
+	// set by a Decoder created with WithNamespaces and nil for names
+	// without a namespace.
+	Namespace []byte
 }
 
 // Attr is an attribute of an element.
@@ -13,6 +18,24 @@ type Attr struct {
 	Name        Name
 	Value       []byte
 	SingleQuote bool
+
+	// Space is the whitespace preceding the attribute and Eq everything
+	// between its name and its value, like " = ".
+	// Both are only recorded by a Decoder in lossless mode (see WithLossless).
+	Space []byte
+	Eq    []byte
+}
+
+// Position is a location in the input of a Decoder.
+type Position struct {
+	// Offset is the byte offset in the input.
+	Offset int
+
+	// Line is the 1-based line number.
+	Line int
+
+	// Column is the 1-based column number in bytes.
+	Column int
 }
 
 // constants for Token.Kind
@@ -24,6 +47,7 @@ const (
 	TokenTypeDirective
 	TokenTypeTextElement
 	TokenTypeCharData
+	TokenTypeComment
 )
 
 // Token represents the union of all possible token types
@@ -35,8 +59,31 @@ type Token struct {
 	// only for TokenTypeStartElement
 	Attr []Attr
 
-	// only for TokenTypeDirective, TokenTypeTextElement, TokenTypeCharData and TokenTypeProcInst
+	// only for TokenTypeDirective, TokenTypeTextElement, TokenTypeCharData, TokenTypeComment
+	// and TokenTypeProcInst.
+	// For TokenTypeDirective this is everything between the "<!" and the closing ">",
+	// like "DOCTYPE html". The Encoder writes ByteData of a directive which
+	// already starts with "<!" verbatim, without adding the delimiters.
+	// For TokenTypeProcInst in lossless mode (see WithLossless), this is everything
+	// between the target and the closing "?>", including any whitespace.
 	ByteData []byte
 
+	// only for TokenTypeStartElement and TokenTypeEndElement in lossless mode
+	// (see WithLossless): the whitespace before the closing ">" or "/>".
+	Space []byte
+
+	// only for TokenTypeStartElement and TokenTypeEndElement: whether the
+	// element was written as self-closing "<a/>" instead of "<a></a>".
+	// The end element of a self-closing element is implied by its "/>".
+	SelfClosing bool
+
 	Kind byte
 }
+
+// String returns the qualified name, like "prefix:local".
+func (n Name) String() string {
+	if len(n.Prefix) > 0 {
+		return string(n.Prefix) + ":" + string(n.Local)
+	}
+	return string(n.Local)
+}
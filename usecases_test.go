@@ -64,6 +64,33 @@ soap:encodingStyle="http://www.w3.org/2003/05/soap-encoding">
 		"<b:Item>Apples</b:Item></b:GetPrice></a:Body></a:Envelope>", w.String())
 }
 
+func TestKeepCommentsInConfigFile(t *testing.T) {
+	// given
+	input := `<config><!-- the port to listen on --><port>8080</port></config>`
+	dec := gosaxml.NewDecoder(strings.NewReader(input), gosaxml.WithComments())
+	w := &bytes.Buffer{}
+	enc := gosaxml.NewEncoder(w)
+	var tk gosaxml.Token
+
+	// when
+	for {
+		err := dec.NextToken(&tk)
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		if tk.Kind == gosaxml.TokenTypeTextElement && string(tk.ByteData) == "8080" {
+			tk.ByteData = []byte("9090")
+		}
+		err = enc.EncodeToken(&tk)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, enc.Flush())
+
+	// then
+	assert.Equal(t, `<config><!-- the port to listen on --><port>9090</port></config>`, w.String())
+}
+
 func addEndElement(t *testing.T, enc *gosaxml.Encoder) {
 	err := enc.EncodeToken(&gosaxml.Token{
 		Kind: gosaxml.TokenTypeEndElement,